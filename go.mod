@@ -3,8 +3,15 @@ module github.com/pottava/aws-s3-proxy
 go 1.13
 
 require (
+	github.com/andybalholm/brotli v1.0.0
 	github.com/aws/aws-sdk-go v1.25.25
+	github.com/coreos/go-oidc v2.2.1+incompatible
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-openapi/swag v0.19.5
+	github.com/klauspost/compress v1.10.3
+	github.com/pquerna/cachecontrol v0.0.0-20180517163645-1555304b9b35 // indirect
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	gopkg.in/square/go-jose.v2 v2.4.1
 )
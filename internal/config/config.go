@@ -12,40 +12,99 @@ var (
 	Config *config
 )
 
+// DefaultContentEncodingTypes are the media types compressed by default
+const DefaultContentEncodingTypes = "text/*,application/json,application/javascript," +
+	"application/xml,application/xhtml+xml,application/rss+xml,application/atom+xml," +
+	"application/wasm,application/x-ndjson,image/svg+xml"
+
 func init() {
 	Setup()
 }
 
 type config struct { // nolint
-	AwsRegion          string        // AWS_REGION
-	AwsAPIEndpoint     string        // AWS_API_ENDPOINT
-	S3Bucket           string        // AWS_S3_BUCKET
-	S3KeyPrefix        string        // AWS_S3_KEY_PREFIX
-	IndexDocument      string        // INDEX_DOCUMENT
-	DirectoryListing   bool          // DIRECTORY_LISTINGS
-	DirListingFormat   string        // DIRECTORY_LISTINGS_FORMAT
-	HTTPCacheControl   string        // HTTP_CACHE_CONTROL (max-age=86400, no-cache ...)
-	HTTPExpires        string        // HTTP_EXPIRES (Thu, 01 Dec 1994 16:00:00 GMT ...)
-	BasicAuthUser      string        // BASIC_AUTH_USER
-	BasicAuthPass      string        // BASIC_AUTH_PASS
-	Port               string        // APP_PORT
-	Host               string        // APP_HOST
-	AccessLog          bool          // ACCESS_LOG
-	SslCert            string        // SSL_CERT_PATH
-	SslKey             string        // SSL_KEY_PATH
-	StripPath          string        // STRIP_PATH
-	ContentEncoding    bool          // CONTENT_ENCODING
-	CorsAllowOrigin    string        // CORS_ALLOW_ORIGIN
-	CorsAllowMethods   string        // CORS_ALLOW_METHODS
-	CorsAllowHeaders   string        // CORS_ALLOW_HEADERS
-	CorsMaxAge         int64         // CORS_MAX_AGE
-	HealthCheckPath    string        // HEALTHCHECK_PATH
-	AllPagesInDir      bool          // GET_ALL_PAGES_IN_DIR
-	MaxIdleConns       int           // MAX_IDLE_CONNECTIONS
-	IdleConnTimeout    time.Duration // IDLE_CONNECTION_TIMEOUT
-	DisableCompression bool          // DISABLE_COMPRESSION
-	InsecureTLS        bool          // Disables TLS validation on request endpoints.
-	JwtSecretKey       string        // JWT_SECRET_KEY
+	AwsRegion                 string        // AWS_REGION
+	AwsAPIEndpoint            string        // AWS_API_ENDPOINT
+	S3Bucket                  string        // AWS_S3_BUCKET
+	S3KeyPrefix               string        // AWS_S3_KEY_PREFIX
+	IndexDocument             string        // INDEX_DOCUMENT
+	DirectoryListing          bool          // DIRECTORY_LISTINGS
+	DirListingFormat          string        // DIRECTORY_LISTINGS_FORMAT
+	DirListingJSONVersion     int           // DIRECTORY_LISTINGS_JSON_VERSION
+	DirListingTemplate        string        // DIRECTORY_LISTINGS_TEMPLATE
+	DirListingTemplateS3Key   string        // DIRECTORY_LISTINGS_TEMPLATE_S3_KEY
+	HTTPCacheControl          string        // HTTP_CACHE_CONTROL (max-age=86400, no-cache ...)
+	HTTPExpires               string        // HTTP_EXPIRES (Thu, 01 Dec 1994 16:00:00 GMT ...)
+	BasicAuthUser             string        // BASIC_AUTH_USER
+	BasicAuthPass             string        // BASIC_AUTH_PASS
+	BasicAuthHtpasswd         string        // BASIC_AUTH_HTPASSWD
+	Port                      string        // APP_PORT
+	Host                      string        // APP_HOST
+	Socket                    string        // APP_SOCKET
+	SocketMode                os.FileMode   // APP_SOCKET_MODE
+	HTTPSPort                 string        // HTTPS_PORT
+	ProxyProtocol             bool          // PROXY_PROTOCOL
+	ProxyProtocolTrusted      string        // PROXY_PROTOCOL_TRUSTED_CIDRS
+	HTTPRedirectToHTTPS       bool          // HTTP_REDIRECT_TO_HTTPS
+	HstsMaxAge                int64         // HSTS_MAX_AGE
+	HstsIncludeSubdomains     bool          // HSTS_INCLUDE_SUBDOMAINS
+	HstsPreload               bool          // HSTS_PRELOAD
+	AccessLog                 bool          // ACCESS_LOG
+	SslCert                   string        // SSL_CERT_PATH
+	SslKey                    string        // SSL_KEY_PATH
+	TLSMinVersion             string        // TLS_MIN_VERSION (1.0, 1.1, 1.2, 1.3)
+	TLSCipherSuites           string        // TLS_CIPHER_SUITES
+	AcmeHosts                 string        // ACME_HOSTS
+	AcmeEmail                 string        // ACME_EMAIL
+	AcmeDirectoryURL          string        // ACME_DIRECTORY_URL
+	AcmeCacheDir              string        // ACME_CACHE_DIR
+	AcmeCacheS3Bucket         string        // ACME_CACHE_S3_BUCKET
+	AcmeCacheS3Prefix         string        // ACME_CACHE_S3_PREFIX
+	AcmeHTTPPort              string        // ACME_HTTP_PORT
+	SslClientCA               string        // SSL_CLIENT_CA_PATH
+	SslClientAuth             string        // SSL_CLIENT_AUTH (require, verify_if_given)
+	ClientCertIdentity        string        // CLIENT_CERT_IDENTITY (cn, dns, email, uri)
+	ClientCertPrefixes        string        // CLIENT_CERT_PREFIXES (identity=/prefix/ /other/;identity2=...)
+	PrecompressedEncodings    string        // PRECOMPRESSED_ENCODINGS (br,zstd,gzip)
+	HiddenPatterns            string        // HIDDEN_PATTERNS (*.tmp,.git/**,_private/,re:regexp)
+	StripPath                 string        // STRIP_PATH
+	ContentEncoding           bool          // CONTENT_ENCODING
+	ContentEncodingAlgorithms string        // CONTENT_ENCODING_ALGORITHMS
+	ContentEncodingTypes      string        // CONTENT_ENCODING_TYPES
+	ContentEncodingMinSize    int64         // CONTENT_ENCODING_MIN_SIZE
+	CorsAllowOrigin           string        // CORS_ALLOW_ORIGIN
+	CorsAllowMethods          string        // CORS_ALLOW_METHODS
+	CorsAllowHeaders          string        // CORS_ALLOW_HEADERS
+	CorsMaxAge                int64         // CORS_MAX_AGE
+	HealthCheckPath           string        // HEALTHCHECK_PATH
+	AllPagesInDir             bool          // GET_ALL_PAGES_IN_DIR
+	ParallelGetThreshold      int64         // PARALLEL_GET_THRESHOLD
+	ParallelGetPartSize       int64         // PARALLEL_GET_PART_SIZE
+	ParallelGetConcurrency    int           // PARALLEL_GET_CONCURRENCY
+	DownloadConcurrency       int           // DOWNLOAD_CONCURRENCY
+	ArchiveBrowsing           bool          // ARCHIVE_BROWSING
+	SymlinkBuckets            string        // SYMLINK_BUCKETS
+	MaxIdleConns              int           // MAX_IDLE_CONNECTIONS
+	IdleConnTimeout           time.Duration // IDLE_CONNECTION_TIMEOUT
+	DisableCompression        bool          // DISABLE_COMPRESSION
+	InsecureTLS               bool          // Disables TLS validation on request endpoints.
+	JwtSecretKey              string        // JWT_SECRET_KEY
+	APIKeysFile               string        // API_KEYS_FILE
+	TrustedProxies            string        // TRUSTED_PROXIES
+	TrustedProxyHeader        string        // TRUSTED_PROXY_HEADER (X-Forwarded-For, Forwarded or X-Real-IP)
+	IPAllowList               string        // IP_ALLOW_LIST
+	IPDenyList                string        // IP_DENY_LIST
+	IPAllowByPrefix           string        // IP_ALLOW_BY_PREFIX (/prefix/=10.0.0.0/8 192.168.0.0/16;/other/=...)
+	IPDenyByPrefix            string        // IP_DENY_BY_PREFIX
+	OidcIssuer                string        // OIDC_ISSUER
+	OidcClientID              string        // OIDC_CLIENT_ID
+	OidcClientSecret          string        // OIDC_CLIENT_SECRET
+	OidcRedirectURL           string        // OIDC_REDIRECT_URL
+	OidcScopes                string        // OIDC_SCOPES
+	OidcAllowedDomains        string        // OIDC_ALLOWED_DOMAINS
+	OidcAllowedGroups         string        // OIDC_ALLOWED_GROUPS
+	OidcGroupsClaim           string        // OIDC_GROUPS_CLAIM
+	OidcSessionSecret         string        // OIDC_SESSION_SECRET
+	OidcSessionTTL            time.Duration // OIDC_SESSION_TTL
 }
 
 // Setup configurations with environment variables
@@ -66,6 +125,30 @@ func Setup() {
 	if b, err := strconv.ParseBool(os.Getenv("DIRECTORY_LISTINGS")); err == nil {
 		directoryListings = b
 	}
+	socketMode := os.FileMode(0660)
+	if b, err := strconv.ParseUint(os.Getenv("APP_SOCKET_MODE"), 8, 32); err == nil {
+		socketMode = os.FileMode(b)
+	}
+	proxyProtocol := false
+	if b, err := strconv.ParseBool(os.Getenv("PROXY_PROTOCOL")); err == nil {
+		proxyProtocol = b
+	}
+	httpRedirectToHTTPS := false
+	if b, err := strconv.ParseBool(os.Getenv("HTTP_REDIRECT_TO_HTTPS")); err == nil {
+		httpRedirectToHTTPS = b
+	}
+	hstsMaxAge := int64(0)
+	if i, err := strconv.ParseInt(os.Getenv("HSTS_MAX_AGE"), 10, 64); err == nil {
+		hstsMaxAge = i
+	}
+	hstsIncludeSubdomains := false
+	if b, err := strconv.ParseBool(os.Getenv("HSTS_INCLUDE_SUBDOMAINS")); err == nil {
+		hstsIncludeSubdomains = b
+	}
+	hstsPreload := false
+	if b, err := strconv.ParseBool(os.Getenv("HSTS_PRELOAD")); err == nil {
+		hstsPreload = b
+	}
 	accessLog := false
 	if b, err := strconv.ParseBool(os.Getenv("ACCESS_LOG")); err == nil {
 		accessLog = b
@@ -86,6 +169,30 @@ func Setup() {
 	if b, err := strconv.ParseInt(os.Getenv("MAX_IDLE_CONNECTIONS"), 10, 16); err == nil {
 		maxIdleConns = int(b)
 	}
+	dirListingJSONVersion := 1
+	if b, err := strconv.Atoi(os.Getenv("DIRECTORY_LISTINGS_JSON_VERSION")); err == nil {
+		dirListingJSONVersion = b
+	}
+	parallelGetThreshold := int64(0)
+	if b, err := strconv.ParseInt(os.Getenv("PARALLEL_GET_THRESHOLD"), 10, 64); err == nil {
+		parallelGetThreshold = b
+	}
+	parallelGetPartSize := int64(8 * 1024 * 1024)
+	if b, err := strconv.ParseInt(os.Getenv("PARALLEL_GET_PART_SIZE"), 10, 64); err == nil && b > 0 {
+		parallelGetPartSize = b
+	}
+	parallelGetConcurrency := 4
+	if b, err := strconv.Atoi(os.Getenv("PARALLEL_GET_CONCURRENCY")); err == nil && b > 0 {
+		parallelGetConcurrency = b
+	}
+	downloadConcurrency := 4
+	if b, err := strconv.Atoi(os.Getenv("DOWNLOAD_CONCURRENCY")); err == nil && b > 0 {
+		downloadConcurrency = b
+	}
+	archiveBrowsing := false
+	if b, err := strconv.ParseBool(os.Getenv("ARCHIVE_BROWSING")); err == nil {
+		archiveBrowsing = b
+	}
 	idleConnTimeout := time.Duration(10) * time.Second
 	if b, err := strconv.ParseInt(os.Getenv("IDLE_CONNECTION_TIMEOUT"), 10, 64); err == nil {
 		idleConnTimeout = time.Duration(b) * time.Second
@@ -98,49 +205,165 @@ func Setup() {
 	if b, err := strconv.ParseBool(os.Getenv("INSECURE_TLS")); err == nil {
 		insecureTLS = b
 	}
+	acmeDirectoryURL := os.Getenv("ACME_DIRECTORY_URL")
+	if len(acmeDirectoryURL) == 0 {
+		acmeDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+	}
+	acmeCacheS3Bucket := os.Getenv("ACME_CACHE_S3_BUCKET")
+	if len(acmeCacheS3Bucket) == 0 {
+		acmeCacheS3Bucket = os.Getenv("AWS_S3_BUCKET")
+	}
+	sslClientAuth := os.Getenv("SSL_CLIENT_AUTH")
+	if len(sslClientAuth) == 0 {
+		sslClientAuth = "require"
+	}
+	contentEncodingAlgorithms := os.Getenv("CONTENT_ENCODING_ALGORITHMS")
+	if len(contentEncodingAlgorithms) == 0 {
+		contentEncodingAlgorithms = "br,zstd,gzip,deflate"
+	}
+	contentEncodingTypes := os.Getenv("CONTENT_ENCODING_TYPES")
+	if len(contentEncodingTypes) == 0 {
+		contentEncodingTypes = DefaultContentEncodingTypes
+	}
+	contentEncodingMinSize := int64(1024)
+	if b, err := strconv.ParseInt(os.Getenv("CONTENT_ENCODING_MIN_SIZE"), 10, 64); err == nil {
+		contentEncodingMinSize = b
+	}
+	trustedProxyHeader := os.Getenv("TRUSTED_PROXY_HEADER")
+	if len(trustedProxyHeader) == 0 {
+		trustedProxyHeader = "X-Forwarded-For"
+	}
+	oidcScopes := os.Getenv("OIDC_SCOPES")
+	if len(oidcScopes) == 0 {
+		oidcScopes = "openid,email,profile"
+	}
+	oidcGroupsClaim := os.Getenv("OIDC_GROUPS_CLAIM")
+	if len(oidcGroupsClaim) == 0 {
+		oidcGroupsClaim = "groups"
+	}
+	oidcSessionTTL := time.Duration(12) * time.Hour
+	if b, err := strconv.ParseInt(os.Getenv("OIDC_SESSION_TTL"), 10, 64); err == nil {
+		oidcSessionTTL = time.Duration(b) * time.Second
+	}
 	Config = &config{
-		AwsRegion:          region,
-		AwsAPIEndpoint:     os.Getenv("AWS_API_ENDPOINT"),
-		S3Bucket:           os.Getenv("AWS_S3_BUCKET"),
-		S3KeyPrefix:        os.Getenv("AWS_S3_KEY_PREFIX"),
-		IndexDocument:      indexDocument,
-		DirectoryListing:   directoryListings,
-		DirListingFormat:   os.Getenv("DIRECTORY_LISTINGS_FORMAT"),
-		HTTPCacheControl:   os.Getenv("HTTP_CACHE_CONTROL"),
-		HTTPExpires:        os.Getenv("HTTP_EXPIRES"),
-		BasicAuthUser:      os.Getenv("BASIC_AUTH_USER"),
-		BasicAuthPass:      os.Getenv("BASIC_AUTH_PASS"),
-		Port:               port,
-		Host:               os.Getenv("APP_HOST"),
-		AccessLog:          accessLog,
-		SslCert:            os.Getenv("SSL_CERT_PATH"),
-		SslKey:             os.Getenv("SSL_KEY_PATH"),
-		StripPath:          os.Getenv("STRIP_PATH"),
-		ContentEncoding:    contentEncoding,
-		CorsAllowOrigin:    os.Getenv("CORS_ALLOW_ORIGIN"),
-		CorsAllowMethods:   os.Getenv("CORS_ALLOW_METHODS"),
-		CorsAllowHeaders:   os.Getenv("CORS_ALLOW_HEADERS"),
-		CorsMaxAge:         corsMaxAge,
-		HealthCheckPath:    os.Getenv("HEALTHCHECK_PATH"),
-		AllPagesInDir:      allPagesInDir,
-		MaxIdleConns:       maxIdleConns,
-		IdleConnTimeout:    idleConnTimeout,
-		DisableCompression: disableCompression,
-		InsecureTLS:        insecureTLS,
-		JwtSecretKey:       os.Getenv("JWT_SECRET_KEY"),
+		AwsRegion:                 region,
+		AwsAPIEndpoint:            os.Getenv("AWS_API_ENDPOINT"),
+		S3Bucket:                  os.Getenv("AWS_S3_BUCKET"),
+		S3KeyPrefix:               os.Getenv("AWS_S3_KEY_PREFIX"),
+		IndexDocument:             indexDocument,
+		DirectoryListing:          directoryListings,
+		DirListingFormat:          os.Getenv("DIRECTORY_LISTINGS_FORMAT"),
+		DirListingJSONVersion:     dirListingJSONVersion,
+		DirListingTemplate:        os.Getenv("DIRECTORY_LISTINGS_TEMPLATE"),
+		DirListingTemplateS3Key:   os.Getenv("DIRECTORY_LISTINGS_TEMPLATE_S3_KEY"),
+		HTTPCacheControl:          os.Getenv("HTTP_CACHE_CONTROL"),
+		HTTPExpires:               os.Getenv("HTTP_EXPIRES"),
+		BasicAuthUser:             os.Getenv("BASIC_AUTH_USER"),
+		BasicAuthPass:             os.Getenv("BASIC_AUTH_PASS"),
+		BasicAuthHtpasswd:         os.Getenv("BASIC_AUTH_HTPASSWD"),
+		Port:                      port,
+		Host:                      os.Getenv("APP_HOST"),
+		Socket:                    os.Getenv("APP_SOCKET"),
+		SocketMode:                socketMode,
+		HTTPSPort:                 os.Getenv("HTTPS_PORT"),
+		ProxyProtocol:             proxyProtocol,
+		ProxyProtocolTrusted:      os.Getenv("PROXY_PROTOCOL_TRUSTED_CIDRS"),
+		HTTPRedirectToHTTPS:       httpRedirectToHTTPS,
+		HstsMaxAge:                hstsMaxAge,
+		HstsIncludeSubdomains:     hstsIncludeSubdomains,
+		HstsPreload:               hstsPreload,
+		AccessLog:                 accessLog,
+		SslCert:                   os.Getenv("SSL_CERT_PATH"),
+		SslKey:                    os.Getenv("SSL_KEY_PATH"),
+		TLSMinVersion:             os.Getenv("TLS_MIN_VERSION"),
+		TLSCipherSuites:           os.Getenv("TLS_CIPHER_SUITES"),
+		AcmeHosts:                 os.Getenv("ACME_HOSTS"),
+		AcmeEmail:                 os.Getenv("ACME_EMAIL"),
+		AcmeDirectoryURL:          acmeDirectoryURL,
+		AcmeCacheDir:              os.Getenv("ACME_CACHE_DIR"),
+		AcmeCacheS3Bucket:         acmeCacheS3Bucket,
+		AcmeCacheS3Prefix:         os.Getenv("ACME_CACHE_S3_PREFIX"),
+		AcmeHTTPPort:              os.Getenv("ACME_HTTP_PORT"),
+		SslClientCA:               os.Getenv("SSL_CLIENT_CA_PATH"),
+		SslClientAuth:             sslClientAuth,
+		ClientCertIdentity:        os.Getenv("CLIENT_CERT_IDENTITY"),
+		ClientCertPrefixes:        os.Getenv("CLIENT_CERT_PREFIXES"),
+		PrecompressedEncodings:    os.Getenv("PRECOMPRESSED_ENCODINGS"),
+		HiddenPatterns:            os.Getenv("HIDDEN_PATTERNS"),
+		StripPath:                 os.Getenv("STRIP_PATH"),
+		ContentEncoding:           contentEncoding,
+		ContentEncodingAlgorithms: contentEncodingAlgorithms,
+		ContentEncodingTypes:      contentEncodingTypes,
+		ContentEncodingMinSize:    contentEncodingMinSize,
+		CorsAllowOrigin:           os.Getenv("CORS_ALLOW_ORIGIN"),
+		CorsAllowMethods:          os.Getenv("CORS_ALLOW_METHODS"),
+		CorsAllowHeaders:          os.Getenv("CORS_ALLOW_HEADERS"),
+		CorsMaxAge:                corsMaxAge,
+		HealthCheckPath:           os.Getenv("HEALTHCHECK_PATH"),
+		AllPagesInDir:             allPagesInDir,
+		ParallelGetThreshold:      parallelGetThreshold,
+		ParallelGetPartSize:       parallelGetPartSize,
+		ParallelGetConcurrency:    parallelGetConcurrency,
+		DownloadConcurrency:       downloadConcurrency,
+		ArchiveBrowsing:           archiveBrowsing,
+		SymlinkBuckets:            os.Getenv("SYMLINK_BUCKETS"),
+		MaxIdleConns:              maxIdleConns,
+		IdleConnTimeout:           idleConnTimeout,
+		DisableCompression:        disableCompression,
+		InsecureTLS:               insecureTLS,
+		JwtSecretKey:              os.Getenv("JWT_SECRET_KEY"),
+		APIKeysFile:               os.Getenv("API_KEYS_FILE"),
+		TrustedProxies:            os.Getenv("TRUSTED_PROXIES"),
+		TrustedProxyHeader:        trustedProxyHeader,
+		IPAllowList:               os.Getenv("IP_ALLOW_LIST"),
+		IPDenyList:                os.Getenv("IP_DENY_LIST"),
+		IPAllowByPrefix:           os.Getenv("IP_ALLOW_BY_PREFIX"),
+		IPDenyByPrefix:            os.Getenv("IP_DENY_BY_PREFIX"),
+		OidcIssuer:                os.Getenv("OIDC_ISSUER"),
+		OidcClientID:              os.Getenv("OIDC_CLIENT_ID"),
+		OidcClientSecret:          os.Getenv("OIDC_CLIENT_SECRET"),
+		OidcRedirectURL:           os.Getenv("OIDC_REDIRECT_URL"),
+		OidcScopes:                oidcScopes,
+		OidcAllowedDomains:        os.Getenv("OIDC_ALLOWED_DOMAINS"),
+		OidcAllowedGroups:         os.Getenv("OIDC_ALLOWED_GROUPS"),
+		OidcGroupsClaim:           oidcGroupsClaim,
+		OidcSessionSecret:         os.Getenv("OIDC_SESSION_SECRET"),
+		OidcSessionTTL:            oidcSessionTTL,
 	}
 	// Proxy
 	log.Printf("[config] Proxy to %v", Config.S3Bucket)
 	log.Printf("[config] AWS Region: %v", Config.AwsRegion)
 
+	// ACME
+	if len(Config.AcmeHosts) > 0 {
+		log.Printf("[config] ACME enabled: %s (%s)", Config.AcmeHosts, Config.AcmeDirectoryURL)
+
+		if len(Config.AcmeCacheS3Prefix) > 0 && Config.AcmeCacheS3Bucket == Config.S3Bucket {
+			log.Printf("[config] ACME cache: keys under %s are never served. Consider ACME_CACHE_S3_BUCKET.", Config.AcmeCacheS3Prefix)
+		}
+	}
 	// TLS pem files
-	if (len(Config.SslCert) > 0) && (len(Config.SslKey) > 0) {
+	if (len(Config.SslCert) > 0) && (len(Config.SslKey) > 0) || (len(Config.AcmeHosts) > 0) {
 		log.Print("[config] TLS enabled.")
+
+		if len(Config.SslClientCA) > 0 {
+			log.Printf("[config] TLS client authentication: %s", Config.SslClientAuth)
+		}
 	}
 	// Basic authentication
-	if (len(Config.BasicAuthUser) > 0) && (len(Config.BasicAuthPass) > 0) {
+	if len(Config.BasicAuthHtpasswd) > 0 {
+		log.Printf("[config] Basic authentication: %s", Config.BasicAuthHtpasswd)
+	} else if (len(Config.BasicAuthUser) > 0) && (len(Config.BasicAuthPass) > 0) {
 		log.Printf("[config] Basic authentication: %s", Config.BasicAuthUser)
 	}
+	// API keys
+	if len(Config.APIKeysFile) > 0 {
+		log.Printf("[config] API keys: %s", Config.APIKeysFile)
+	}
+	// OpenID Connect
+	if len(Config.OidcIssuer) > 0 {
+		log.Printf("[config] OpenID Connect: %s", Config.OidcIssuer)
+	}
 	// CORS
 	if (len(Config.CorsAllowOrigin) > 0) && (Config.CorsMaxAge > 0) {
 		log.Printf("[config] CORS enabled: %s", Config.CorsAllowOrigin)
@@ -10,34 +10,49 @@ import (
 
 func defaultConfig() *config {
 	return &config{
-		AwsRegion:          "",
-		AwsAPIEndpoint:     "",
-		S3Bucket:           "",
-		S3KeyPrefix:        "",
-		IndexDocument:      "index.html",
-		DirectoryListing:   false,
-		DirListingFormat:   "",
-		HTTPCacheControl:   "",
-		HTTPExpires:        "",
-		BasicAuthUser:      "",
-		BasicAuthPass:      "",
-		Port:               "80",
-		Host:               "",
-		AccessLog:          false,
-		SslCert:            "",
-		SslKey:             "",
-		StripPath:          "",
-		ContentEncoding:    true,
-		CorsAllowOrigin:    "",
-		CorsAllowMethods:   "",
-		CorsAllowHeaders:   "",
-		CorsMaxAge:         int64(600),
-		HealthCheckPath:    "",
-		AllPagesInDir:      false,
-		MaxIdleConns:       150,
-		IdleConnTimeout:    time.Duration(10) * time.Second,
-		DisableCompression: true,
-		InsecureTLS:        false,
+		AwsRegion:                 "",
+		AwsAPIEndpoint:            "",
+		S3Bucket:                  "",
+		S3KeyPrefix:               "",
+		IndexDocument:             "index.html",
+		DirectoryListing:          false,
+		DirListingFormat:          "",
+		DirListingJSONVersion:     1,
+		HTTPCacheControl:          "",
+		HTTPExpires:               "",
+		BasicAuthUser:             "",
+		BasicAuthPass:             "",
+		Port:                      "80",
+		Host:                      "",
+		SocketMode:                os.FileMode(0660),
+		AccessLog:                 false,
+		SslCert:                   "",
+		SslKey:                    "",
+		AcmeDirectoryURL:          "https://acme-v02.api.letsencrypt.org/directory",
+		SslClientAuth:             "require",
+		StripPath:                 "",
+		ContentEncoding:           true,
+		ContentEncodingAlgorithms: "br,zstd,gzip,deflate",
+		ContentEncodingTypes:      DefaultContentEncodingTypes,
+		ContentEncodingMinSize:    1024,
+		CorsAllowOrigin:           "",
+		CorsAllowMethods:          "",
+		CorsAllowHeaders:          "",
+		CorsMaxAge:                int64(600),
+		HealthCheckPath:           "",
+		AllPagesInDir:             false,
+		ParallelGetPartSize:       8 * 1024 * 1024,
+		ParallelGetConcurrency:    4,
+		DownloadConcurrency:       4,
+		ArchiveBrowsing:           false,
+		MaxIdleConns:              150,
+		IdleConnTimeout:           time.Duration(10) * time.Second,
+		DisableCompression:        true,
+		InsecureTLS:               false,
+		TrustedProxyHeader:        "X-Forwarded-For",
+		OidcScopes:                "openid,email,profile",
+		OidcGroupsClaim:           "groups",
+		OidcSessionTTL:            time.Duration(12) * time.Hour,
 	}
 }
 
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 serves objects from memory
+type fakeS3 struct {
+	objects map[string]string
+	types   map[string]string
+	listing *s3.ListObjectsV2Output
+	pages   []*s3.ListObjectsV2Output
+	walkErr error
+	ranges  []string // Range headers requested so far, "" for whole objects
+	onGet   func(key string)
+	mu      sync.Mutex
+}
+
+func (f *fakeS3) S3get(bucket, key string, rangeHeader *string) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	obj := &s3.GetObjectOutput{ContentType: aws.String(f.types[key]), ETag: fakeETag(body)}
+	f.mu.Lock()
+	f.ranges = append(f.ranges, aws.StringValue(rangeHeader))
+	f.mu.Unlock()
+	if f.onGet != nil {
+		defer f.onGet(key)
+	}
+
+	// Only "bytes=first-last" is supported
+	if rangeHeader != nil {
+		var first, last int
+		if _, err := fmt.Sscanf(*rangeHeader, "bytes=%d-%d", &first, &last); err != nil || first >= len(body) {
+			return nil, awserr.New(errCodeInvalidRange, "invalid range", nil)
+		}
+		if last >= len(body) {
+			last = len(body) - 1
+		}
+		obj.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", first, last, len(body)))
+		body = body[first : last+1]
+	}
+	obj.Body = ioutil.NopCloser(strings.NewReader(body))
+	obj.ContentLength = aws.Int64(int64(len(body)))
+	return obj, nil
+}
+
+func (f *fakeS3) S3getIfMatch(bucket, key string, rangeHeader, eTag *string) (*s3.GetObjectOutput, error) {
+	if body, ok := f.objects[key]; ok && aws.StringValue(fakeETag(body)) != aws.StringValue(eTag) {
+		return nil, awserr.New("PreconditionFailed", "precondition failed", nil)
+	}
+	return f.S3get(bucket, key, rangeHeader)
+}
+
+func fakeETag(body string) *string {
+	return aws.String(fmt.Sprintf(`"%x"`, md5.Sum([]byte(body))))
+}
+
+func (f *fakeS3) S3listObjects(bucket, prefix string, maxKeys int64, continuationToken *string) (*s3.ListObjectsV2Output, error) {
+	if f.listing != nil {
+		// The page after the listing is the last one, and empty
+		if next := f.listing.NextContinuationToken; next != nil && aws.StringValue(continuationToken) == *next {
+			return &s3.ListObjectsV2Output{}, nil
+		}
+		return f.listing, nil
+	}
+	// Pages are continued with their index
+	if len(f.pages) > 0 {
+		index, _ := strconv.Atoi(aws.StringValue(continuationToken))
+		page := *f.pages[index]
+		if index+1 < len(f.pages) {
+			page.NextContinuationToken = aws.String(strconv.Itoa(index + 1))
+		}
+		return &page, nil
+	}
+	return &s3.ListObjectsV2Output{}, nil
+}
+
+func (f *fakeS3) S3walkObjects(bucket, prefix string, fn func(page *s3.ListObjectsV2Output) bool) error {
+	for _, page := range f.pages {
+		if !fn(page) {
+			break
+		}
+	}
+	return f.walkErr
+}
+
+func (f *fakeS3) S3head(bucket, key string) (*s3.HeadObjectOutput, error) {
+	body, ok := f.objects[key]
+	if !ok {
+		return nil, awserr.New(errCodeNotFound, "not found", nil)
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String(f.types[key]),
+	}, nil
+}
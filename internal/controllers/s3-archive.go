@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// archiveSeparator separates the key of an archive from the path of a member,
+// e.g. /builds/123.zip!/docs/index.html
+const archiveSeparator = "!/"
+
+// Zip central directories are read in blocks of this size
+const archiveBlockSize = 256 * 1024
+
+// Kinds of archives which can be browsed
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+var errNoSuchMember = awserr.New(s3.ErrCodeNoSuchKey, "The specified member does not exist in the archive.", nil)
+
+// archiveKind returns the kind of the archive by its extension, if any
+func archiveKind(key string) string {
+	lower := strings.ToLower(key)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	}
+	return ""
+}
+
+// archiveFile is a file or a directory in an archive
+type archiveFile struct {
+	name     string
+	size     int64
+	modified time.Time
+	etag     string
+}
+
+// memberName returns the name of a member relative to the root of the archive,
+// or false if it could point outside of it
+func memberName(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	trimmed := strings.TrimSuffix(name, "/")
+	if len(trimmed) == 0 || strings.HasPrefix(name, "/") || path.Clean(trimmed) != trimmed ||
+		trimmed == ".." || strings.HasPrefix(trimmed, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// s3archive serves a member of the archive, or lists a directory in it
+func s3archive(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, key, member string) {
+	key = strings.TrimPrefix(key, "/")
+	kind := archiveKind(key)
+	if len(kind) == 0 || hiddenKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+	if len(member) == 0 || strings.HasSuffix(member, "/") {
+		if config.Config.DirectoryListing {
+			s3archiveListing(w, r, client, bucket, key, kind, member)
+			return
+		}
+		member += config.Config.IndexDocument
+	}
+	var obj *s3.GetObjectOutput
+	var err error
+	if kind == archiveZip {
+		obj, err = zipMember(client, bucket, key, member)
+	} else {
+		obj, err = tarMember(client, bucket, key, member, kind == archiveTarGz)
+	}
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
+	}
+	defer obj.Body.Close()
+
+	c := config.Config
+	setHeadersFromAwsResponse(w, obj, c.HTTPCacheControl, c.HTTPExpires)
+	io.Copy(w, obj.Body) // nolint
+}
+
+// s3archiveListing lists the directory in the archive as if it were a prefix in the bucket
+func s3archiveListing(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, key, kind, dir string) {
+	var files []archiveFile
+	var err error
+	if kind == archiveZip {
+		files, err = zipFiles(client, bucket, key)
+	} else {
+		files, err = tarFiles(client, bucket, key, kind == archiveTarGz)
+	}
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
+	}
+	prefix := key + archiveSeparator + dir
+	result := &s3.ListObjectsV2Output{Prefix: aws.String(prefix)}
+	found := len(dir) == 0
+	dirs := map[string]bool{}
+	for _, file := range files {
+		if !strings.HasPrefix(file.name, dir) {
+			continue
+		}
+		found = true
+		name := strings.TrimPrefix(file.name, dir)
+		if len(name) == 0 {
+			continue
+		}
+		if idx := strings.Index(name, "/"); idx > -1 {
+			if sub := prefix + name[:idx+1]; !dirs[sub] {
+				dirs[sub] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(sub)})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, &s3.Object{
+			Key:          aws.String(prefix + name),
+			Size:         aws.Int64(file.size),
+			LastModified: aws.Time(file.modified),
+			ETag:         aws.String(file.etag),
+		})
+	}
+	if !found {
+		code, message := toHTTPError(errNoSuchMember)
+		http.Error(w, message, code)
+		return
+	}
+	writeListing(w, r, client, result, prefix)
+}
+
+// memberObject describes a member as if it were an object in the bucket
+func memberObject(archive *s3.GetObjectOutput, name string, size int64, modified time.Time, body io.ReadCloser) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		CacheControl:  archive.CacheControl,
+		Expires:       archive.Expires,
+		ContentType:   aws.String(mime.TypeByExtension(path.Ext(name))),
+		ContentLength: aws.Int64(size),
+		LastModified:  aws.Time(modified),
+		Body:          body,
+	}
+}
+
+// archiveReader closes the object when the member in it has been read
+type archiveReader struct {
+	io.Reader
+	body io.Closer
+}
+
+func (a archiveReader) Close() error {
+	return a.body.Close()
+}
+
+// openZip reads the central directory of the zip archive with ranged GETs
+func openZip(client service.AWS, bucket, key string) (*zip.Reader, *s3.HeadObjectOutput, error) {
+	head, err := client.S3head(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := &s3ReaderAt{
+		client: client,
+		bucket: bucket,
+		key:    key,
+		size:   aws.Int64Value(head.ContentLength),
+		blocks: map[int64][]byte{},
+	}
+	archive, err := zip.NewReader(reader, reader.size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, head, nil
+}
+
+func zipFiles(client service.AWS, bucket, key string) ([]archiveFile, error) {
+	archive, _, err := openZip(client, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	files := []archiveFile{}
+	for _, file := range archive.File {
+		name, ok := memberName(file.Name)
+		if !ok {
+			continue
+		}
+		files = append(files, archiveFile{
+			name:     name,
+			size:     int64(file.UncompressedSize64),
+			modified: file.Modified,
+			etag:     fmt.Sprintf("%08x", file.CRC32),
+		})
+	}
+	return files, nil
+}
+
+// zipMember requests the compressed data of the member alone, and inflates it
+func zipMember(client service.AWS, bucket, key, member string) (*s3.GetObjectOutput, error) {
+	archive, head, err := openZip(client, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if name, ok := memberName(file.Name); !ok || name != member {
+			continue
+		}
+		// Neither encrypted members nor other methods are supported
+		if file.Flags&0x1 != 0 || (file.Method != zip.Store && file.Method != zip.Deflate) {
+			return nil, zip.ErrAlgorithm
+		}
+		var body io.ReadCloser = ioutil.NopCloser(strings.NewReader(""))
+		if file.CompressedSize64 > 0 {
+			offset, err := file.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			obj, err := client.S3get(bucket, key, aws.String(fmt.Sprintf("bytes=%d-%d",
+				offset, offset+int64(file.CompressedSize64)-1)))
+			if err != nil {
+				return nil, err
+			}
+			body = obj.Body
+			if file.Method == zip.Deflate {
+				body = archiveReader{Reader: flate.NewReader(obj.Body), body: obj.Body}
+			}
+		}
+		return memberObject(&s3.GetObjectOutput{CacheControl: head.CacheControl, Expires: head.Expires},
+			member, int64(file.UncompressedSize64), file.Modified, body), nil
+	}
+	return nil, errNoSuchMember
+}
+
+// openTar reads the tar archive from the beginning, as it has no index
+func openTar(client service.AWS, bucket, key string, gzipped bool) (*tar.Reader, *s3.GetObjectOutput, error) {
+	obj, err := client.S3get(bucket, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var body io.Reader = obj.Body
+	if gzipped {
+		if body, err = gzip.NewReader(obj.Body); err != nil {
+			obj.Body.Close()
+			return nil, nil, err
+		}
+	}
+	return tar.NewReader(body), obj, nil
+}
+
+func tarFiles(client service.AWS, bucket, key string, gzipped bool) ([]archiveFile, error) {
+	archive, obj, err := openTar(client, bucket, key, gzipped)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	files := []archiveFile{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		mode := header.FileInfo().Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			continue
+		}
+		name, ok := memberName(header.Name)
+		if !ok {
+			continue
+		}
+		if mode.IsDir() && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		files = append(files, archiveFile{name: name, size: header.Size, modified: header.ModTime})
+	}
+}
+
+// tarMember skips to the member and streams it from there
+func tarMember(client service.AWS, bucket, key, member string, gzipped bool) (*s3.GetObjectOutput, error) {
+	archive, obj, err := openTar(client, bucket, key, gzipped)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			obj.Body.Close()
+			if err == io.EOF {
+				return nil, errNoSuchMember
+			}
+			return nil, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if name, ok := memberName(header.Name); ok && name == member {
+			return memberObject(obj, member, header.Size, header.ModTime,
+				archiveReader{Reader: archive, body: obj.Body}), nil
+		}
+	}
+}
+
+// s3ReaderAt reads an object with ranged GETs, archiveBlockSize at a time,
+// and keeps the blocks it has read
+type s3ReaderAt struct {
+	client service.AWS
+	bucket string
+	key    string
+	size   int64
+	blocks map[int64][]byte
+}
+
+func (s *s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off+int64(n) < s.size {
+		pos := off + int64(n)
+		index := pos / archiveBlockSize
+		block, err := s.block(index)
+		if err != nil {
+			return n, err
+		}
+		start := pos - index*archiveBlockSize
+		if start >= int64(len(block)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], block[start:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *s3ReaderAt) block(index int64) ([]byte, error) {
+	if block, ok := s.blocks[index]; ok {
+		return block, nil
+	}
+	first := index * archiveBlockSize
+	last := first + archiveBlockSize - 1
+	if last >= s.size {
+		last = s.size - 1
+	}
+	obj, err := s.client.S3get(s.bucket, s.key, aws.String(fmt.Sprintf("bytes=%d-%d", first, last)))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	block, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.blocks[index] = block
+	return block, nil
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var archiveSample = []struct {
+	name string
+	body string
+}{
+	{"docs/", ""},
+	{"docs/index.html", "<h1>" + strings.Repeat("report ", 100) + "</h1>"},
+	{"docs/img/logo.svg", "<svg/>"},
+	{"README.txt", "read me"},
+	{"../escape.txt", "outside"},
+}
+
+func sampleZip() string {
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	for _, file := range archiveSample {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		header.Modified = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		w, _ := archive.CreateHeader(header)
+		w.Write([]byte(file.body)) // nolint
+	}
+	archive.Close() // nolint
+	return buf.String()
+}
+
+func sampleTarGz() string {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	for _, file := range archiveSample {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: "./" + file.name, Size: int64(len(file.body)), Mode: 0644}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		archive.WriteHeader(header)      // nolint
+		archive.Write([]byte(file.body)) // nolint
+	}
+	archive.Close() // nolint
+	gz.Close()      // nolint
+	return buf.String()
+}
+
+func archiveRequest(client *fakeS3, key, member string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/"+key+archiveSeparator+member, nil)
+	s3archive(w, r, client, "bucket", "/"+key, member)
+	return w
+}
+
+func TestArchiveZipMember(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{"builds/123.zip": sampleZip()}}
+
+	w := archiveRequest(client, "builds/123.zip", "docs/index.html")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, archiveSample[1].body, w.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, strconv.Itoa(len(archiveSample[1].body)), w.Header().Get("Content-Length"))
+	assert.Equal(t, "Thu, 02 Jan 2020 03:04:05 GMT", w.Header().Get("Last-Modified"))
+
+	// The archive is never read as a whole
+	assert.NotEmpty(t, client.ranges)
+	for _, rangeHeader := range client.ranges {
+		assert.True(t, strings.HasPrefix(rangeHeader, "bytes="))
+	}
+
+	w = archiveRequest(client, "builds/123.zip", "docs/missing.html")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = archiveRequest(client, "builds/123.zip", "../escape.txt")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = archiveRequest(client, "builds/124.zip", "docs/index.html")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestArchiveZipListing(t *testing.T) {
+	config.Config.DirectoryListing = true
+	defer func() { config.Config.DirectoryListing = false }()
+	client := &fakeS3{objects: map[string]string{"builds/123.zip": sampleZip()}}
+
+	w := archiveRequest(client, "builds/123.zip", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `["docs/","README.txt"]`+"\n", w.Body.String())
+
+	w = archiveRequest(client, "builds/123.zip", "docs/")
+	assert.Equal(t, `["img/","index.html"]`+"\n", w.Body.String())
+
+	w = archiveRequest(client, "builds/123.zip", "nothing/")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestArchiveIndexDocument(t *testing.T) {
+	config.Config.IndexDocument = "index.html"
+	defer func() { config.Config.IndexDocument = "" }()
+	client := &fakeS3{objects: map[string]string{"builds/123.zip": sampleZip()}}
+
+	w := archiveRequest(client, "builds/123.zip", "docs/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, archiveSample[1].body, w.Body.String())
+}
+
+func TestArchiveTarGz(t *testing.T) {
+	config.Config.DirectoryListing = true
+	defer func() { config.Config.DirectoryListing = false }()
+	client := &fakeS3{objects: map[string]string{"builds/123.tar.gz": sampleTarGz()}}
+
+	w := archiveRequest(client, "builds/123.tar.gz", "docs/img/logo.svg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<svg/>", w.Body.String())
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+
+	w = archiveRequest(client, "builds/123.tar.gz", "docs/")
+	assert.Equal(t, `["img/","index.html"]`+"\n", w.Body.String())
+
+	w = archiveRequest(client, "builds/123.tar.gz", "docs/missing.html")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestArchiveHidden(t *testing.T) {
+	config.Config.DirectoryListing = true
+	config.Config.HiddenPatterns = "*.txt"
+	defer func() {
+		config.Config.DirectoryListing = false
+		config.Config.HiddenPatterns = ""
+	}()
+	client := &fakeS3{objects: map[string]string{"builds/123.zip": sampleZip()}}
+
+	w := archiveRequest(client, "builds/123.zip", "")
+	assert.Equal(t, `["docs/"]`+"\n", w.Body.String())
+}
+
+func TestArchiveKind(t *testing.T) {
+	assert.Equal(t, archiveZip, archiveKind("a/b.ZIP"))
+	assert.Equal(t, archiveTar, archiveKind("a/b.tar"))
+	assert.Equal(t, archiveTarGz, archiveKind("a/b.tgz"))
+	assert.Equal(t, "", archiveKind("a/b.txt"))
+}
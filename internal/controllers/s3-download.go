@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// Archive formats in ?download=
+var archiveTypes = map[string]string{
+	"zip":    "application/zip",
+	"tar":    "application/x-tar",
+	"tar.gz": "application/gzip",
+}
+
+// archiveWriter writes files into an archive as they come
+type archiveWriter interface {
+	addFile(name string, size int64, modified time.Time, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a zipArchive) addFile(name string, size int64, modified time.Time, body io.Reader) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.Modified = modified
+	w, err := a.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+type tarArchive struct {
+	*tar.Writer
+	gzip *gzip.Writer
+}
+
+func (a tarArchive) addFile(name string, size int64, modified time.Time, body io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modified,
+	}
+	if err := a.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.Writer, body)
+	return err
+}
+
+func (a tarArchive) Close() error {
+	if err := a.Writer.Close(); err != nil {
+		return err
+	}
+	if a.gzip != nil {
+		return a.gzip.Close()
+	}
+	return nil
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	switch format {
+	case "zip":
+		return zipArchive{Writer: zip.NewWriter(w)}
+	case "tar.gz":
+		gz := gzip.NewWriter(w)
+		return tarArchive{Writer: tar.NewWriter(gz), gzip: gz}
+	}
+	return tarArchive{Writer: tar.NewWriter(w)}
+}
+
+type archiveMember struct {
+	name   string
+	result chan archiveFetch
+}
+
+type archiveFetch struct {
+	obj *s3.GetObjectOutput
+	err error
+}
+
+// s3download streams an archive of every object under the prefix. Objects are
+// requested concurrently, up to DOWNLOAD_CONCURRENCY ahead of the one being
+// written, and their bodies are copied into the archive one after another.
+func s3download(w http.ResponseWriter, client service.AWS, bucket, prefix, format string) {
+	contentType, ok := archiveTypes[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported download: %s", format), http.StatusBadRequest)
+		return
+	}
+	root := path.Base(strings.TrimSuffix(prefix, "/"))
+	if root == "." || root == "/" {
+		root = bucket
+	}
+	concurrency := config.Config.DownloadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	members := make(chan *archiveMember, concurrency)
+	done := make(chan struct{})
+	walked := make(chan error, 1)
+
+	go func() {
+		defer close(members)
+		walked <- client.S3walkObjects(bucket, prefix, func(page *s3.ListObjectsV2Output) bool {
+			for _, obj := range page.Contents {
+				key := aws.StringValue(obj.Key)
+				if strings.HasSuffix(key, "/") || hiddenKey(key) {
+					continue
+				}
+				// Keys such as "dir/a/../../x" would be extracted outside of the root
+				name, ok := memberName(root + "/" + strings.TrimPrefix(key, prefix))
+				if !ok {
+					continue
+				}
+				member := &archiveMember{
+					name:   name,
+					result: make(chan archiveFetch, 1),
+				}
+				go func(key string) {
+					obj, err := client.S3get(bucket, key, nil)
+					member.result <- archiveFetch{obj: obj, err: err}
+				}(key)
+
+				select {
+				case members <- member:
+				case <-done:
+					discard(member)
+					return false
+				}
+			}
+			return true
+		})
+	}()
+	defer func() {
+		close(done)
+		for member := range members {
+			discard(member)
+		}
+	}()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": root + "." + format,
+	}))
+	archive := newArchiveWriter(format, w)
+
+	written := false
+	for member := range members {
+		fetched := <-member.result
+		if fetched.err != nil {
+			log.Printf("[download] %s: %v", member.name, fetched.err)
+			// The object has been listed, so failing to get it is not the client's fault
+			code, message := toHTTPError(fetched.err)
+			if code < http.StatusInternalServerError {
+				code = http.StatusBadGateway
+			}
+			failDownload(w, written, code, message)
+			return
+		}
+		written = true
+		err := archive.addFile(member.name, aws.Int64Value(fetched.obj.ContentLength),
+			aws.TimeValue(fetched.obj.LastModified), fetched.obj.Body)
+		fetched.obj.Body.Close()
+		if err != nil {
+			log.Printf("[download] %s: %v", member.name, err)
+			failDownload(w, written, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := <-walked; err != nil {
+		log.Printf("[download] %s: %v", prefix, err)
+		code, message := toHTTPError(err)
+		failDownload(w, written, code, message)
+		return
+	}
+	archive.Close() // nolint
+}
+
+// failDownload responds with the error while nothing has been written yet.
+// Otherwise it aborts the connection, so that clients do not take what has
+// been written for a complete archive.
+func failDownload(w http.ResponseWriter, written bool, code int, message string) {
+	if written {
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Del("Content-Disposition")
+	http.Error(w, message, code)
+}
+
+// discard closes the body of a member which is not going to be written
+func discard(member *archiveMember) {
+	if fetched := <-member.result; fetched.obj != nil {
+		fetched.obj.Body.Close()
+	}
+}
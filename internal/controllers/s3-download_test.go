@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func downloadSample() *fakeS3 {
+	return &fakeS3{
+		objects: map[string]string{
+			"dir/a.txt":     "alpha",
+			"dir/sub/b.txt": "bravo",
+			"dir/c.tmp":     "charlie",
+		},
+		pages: []*s3.ListObjectsV2Output{
+			{Contents: []*s3.Object{{Key: aws.String("dir/")}, {Key: aws.String("dir/a.txt")}}},
+			{Contents: []*s3.Object{{Key: aws.String("dir/c.tmp")}, {Key: aws.String("dir/sub/b.txt")}}},
+		},
+	}
+}
+
+func download(client *fakeS3, format string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?download="+format, nil), client, "bucket", "/dir/")
+	return w
+}
+
+func TestDownloadZip(t *testing.T) {
+	config.Config.HiddenPatterns = "*.tmp"
+	defer func() { config.Config.HiddenPatterns = "" }()
+
+	w := download(downloadSample(), "zip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=dir.zip`, w.Header().Get("Content-Disposition"))
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.Nil(t, err)
+	actual := map[string]string{}
+	names := []string{}
+	for _, file := range archive.File {
+		r, _ := file.Open()
+		body, _ := ioutil.ReadAll(r)
+		actual[file.Name] = string(body)
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"dir/a.txt", "dir/sub/b.txt"}, names)
+	assert.Equal(t, "bravo", actual["dir/sub/b.txt"])
+}
+
+func TestDownloadUnsafeNames(t *testing.T) {
+	client := downloadSample()
+	for _, key := range []string{"dir/sub/../../x.txt", "dir//y.txt", "dir/../z.txt"} {
+		client.objects[key] = "unsafe"
+		client.pages[1].Contents = append(client.pages[1].Contents, &s3.Object{Key: aws.String(key)})
+	}
+	w := download(client, "tar")
+	archive := tar.NewReader(w.Body)
+	names := []string{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"dir/a.txt", "dir/c.tmp", "dir/sub/b.txt"}, names)
+}
+
+func TestDownloadTarGz(t *testing.T) {
+	w := download(downloadSample(), "tar.gz")
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+
+	gz, err := gzip.NewReader(w.Body)
+	assert.Nil(t, err)
+	archive := tar.NewReader(gz)
+	names := []string{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(archive)
+		assert.Equal(t, header.Size, int64(len(body)))
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"dir/a.txt", "dir/c.tmp", "dir/sub/b.txt"}, names)
+}
+
+func TestDownloadErrors(t *testing.T) {
+	w := download(downloadSample(), "rar")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	client := downloadSample()
+	client.pages = nil
+	client.walkErr = errors.New("AccessDenied")
+	w = download(client, "tar")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Disposition"))
+
+	// The first object which cannot be fetched fails the download
+	client = downloadSample()
+	delete(client.objects, "dir/a.txt")
+	w = download(client, "zip")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Disposition"))
+	_, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NotNil(t, err)
+}
+
+func TestDownloadAborted(t *testing.T) {
+	// Objects after the first one which cannot be fetched abort the connection
+	client := downloadSample()
+	delete(client.objects, "dir/sub/b.txt")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s3listFiles(w, r, client, "bucket", "/dir/")
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/dir/?download=tar")
+	if err == nil {
+		defer res.Body.Close()
+		archive := tar.NewReader(res.Body)
+		for err == nil {
+			if _, err = archive.Next(); err == nil {
+				_, err = io.Copy(ioutil.Discard, archive)
+			}
+		}
+	}
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
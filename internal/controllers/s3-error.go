@@ -7,11 +7,30 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// S3 responds with this code to a range which cannot be satisfied
+const errCodeInvalidRange = "InvalidRange"
+
+// S3 responds with this code when the object no longer has the ETag in If-Match
+const errCodePreconditionFailed = "PreconditionFailed"
+
+// HEAD responses have no body, so S3 gives this code instead of NoSuchKey
+const errCodeNotFound = "NotFound"
+
 func toHTTPError(err error) (int, string) {
+	switch err {
+	case errSymlinkLoop:
+		return http.StatusLoopDetected, err.Error()
+	case errSymlinkBucket:
+		return http.StatusForbidden, err.Error()
+	}
 	if aerr, ok := err.(awserr.Error); ok {
 		switch aerr.Code() {
-		case s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchKey:
+		case s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchKey, errCodeNotFound:
 			return http.StatusNotFound, aerr.Error()
+		case errCodeInvalidRange:
+			return http.StatusRequestedRangeNotSatisfiable, aerr.Error()
+		case errCodePreconditionFailed:
+			return http.StatusPreconditionFailed, aerr.Error()
 		}
 		return http.StatusInternalServerError, aerr.Error()
 	}
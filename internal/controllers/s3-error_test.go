@@ -58,3 +58,16 @@ func TestToHTTPNoSuchUploadError(t *testing.T) {
 	assert.Equal(t, expectedCode, code)
 	assert.Equal(t, expectedMsg, msg)
 }
+
+func TestToHTTPInvalidRangeError(t *testing.T) {
+	expectedCode := http.StatusRequestedRangeNotSatisfiable
+	expectedMsg := "InvalidRange: 2\ncaused by: 1"
+
+	code, msg := toHTTPError(awserr.New(
+		errCodeInvalidRange,
+		"2",
+		errors.New("1"),
+	))
+	assert.Equal(t, expectedCode, code)
+	assert.Equal(t, expectedMsg, msg)
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+var hiddenCache sync.Map
+
+// hiddenPattern matches keys relative to AWS_S3_KEY_PREFIX
+type hiddenPattern struct {
+	regexp   *regexp.Regexp
+	segments []string // glob split by "/"
+	anywhere bool     // a glob without "/" matches a name at any depth
+	dirOnly  bool     // a glob ending with "/" matches directories only
+}
+
+// parseHiddenPatterns parses HIDDEN_PATTERNS, e.g. "*.tmp,.git/**,_private/,re:^logs/\d+"
+func parseHiddenPatterns(list string) []hiddenPattern {
+	if cached, ok := hiddenCache.Load(list); ok {
+		return cached.([]hiddenPattern)
+	}
+	patterns := []hiddenPattern{}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if len(candidate) == 0 {
+			continue
+		}
+		if strings.HasPrefix(candidate, "re:") {
+			re, err := regexp.Compile(strings.TrimPrefix(candidate, "re:"))
+			if err != nil {
+				log.Printf("[hidden] %s: %v", candidate, err)
+				continue
+			}
+			patterns = append(patterns, hiddenPattern{regexp: re})
+			continue
+		}
+		glob := strings.TrimPrefix(candidate, "/")
+		pattern := hiddenPattern{dirOnly: strings.HasSuffix(glob, "/")}
+		glob = strings.TrimSuffix(glob, "/")
+		pattern.anywhere = !strings.Contains(glob, "/")
+		pattern.segments = strings.Split(glob, "/")
+		if _, err := path.Match(glob, ""); err != nil {
+			log.Printf("[hidden] %s: %v", candidate, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	hiddenCache.Store(list, patterns)
+	return patterns
+}
+
+// hiddenKey reports whether the S3 key, or a directory containing it, matches
+// HIDDEN_PATTERNS. Keys of directories end with "/".
+func hiddenKey(key string) bool {
+	if acmeCacheKey(config.Config.S3Bucket, key) {
+		return true
+	}
+	patterns := parseHiddenPatterns(config.Config.HiddenPatterns)
+	if len(patterns) == 0 {
+		return false
+	}
+	key = strings.TrimPrefix(key, "/")
+	key = strings.TrimPrefix(key, strings.TrimPrefix(config.Config.S3KeyPrefix, "/"))
+	key = strings.TrimPrefix(key, "/")
+
+	isDir := strings.HasSuffix(key, "/")
+	segments := strings.Split(strings.TrimSuffix(key, "/"), "/")
+	for _, pattern := range patterns {
+		if pattern.matches(key, segments, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// acmeCacheKey reports whether the key is under ACME_CACHE_S3_PREFIX in the
+// bucket where certificates and their private keys are cached. It is never served.
+func acmeCacheKey(bucket, key string) bool {
+	c := config.Config
+	if len(c.AcmeCacheS3Prefix) == 0 || bucket != c.AcmeCacheS3Bucket {
+		return false
+	}
+	// S3 keys do not start with "/", and the SDK cleans paths up
+	prefix := strings.TrimLeft(path.Clean("/"+c.AcmeCacheS3Prefix), "/")
+	key = strings.TrimLeft(path.Clean("/"+key), "/")
+	return len(prefix) == 0 || key == prefix || strings.HasPrefix(key, prefix+"/")
+}
+
+func (p hiddenPattern) matches(key string, segments []string, isDir bool) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(key)
+	}
+	// The last segment is a directory only if the key is
+	dirs := len(segments)
+	if !isDir {
+		dirs--
+	}
+	if p.anywhere {
+		for i, segment := range segments {
+			if p.dirOnly && i >= dirs {
+				break
+			}
+			if matched, _ := path.Match(p.segments[0], segment); matched {
+				return true
+			}
+		}
+		return false
+	}
+	// Matching a directory hides everything in it
+	for i := 1; i <= len(segments); i++ {
+		if p.dirOnly && i > dirs {
+			break
+		}
+		if matchSegments(p.segments, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against glob segments, where "**"
+// matches zero or more segments
+func matchSegments(globs, segments []string) bool {
+	if len(globs) == 0 {
+		return len(segments) == 0
+	}
+	if globs[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(globs[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(globs[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(globs[1:], segments[1:])
+}
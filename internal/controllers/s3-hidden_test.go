@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func withHiddenPatterns(patterns, keyPrefix string) func() {
+	config.Config.HiddenPatterns = patterns
+	config.Config.S3KeyPrefix = keyPrefix
+	return func() {
+		config.Config.HiddenPatterns = ""
+		config.Config.S3KeyPrefix = ""
+	}
+}
+
+func TestHiddenKey(t *testing.T) {
+	defer withHiddenPatterns(`*.tmp, .git/**, _private/, docs/internal, re:^logs/\d+$`, "site/")()
+
+	hidden := []string{
+		"site/a.tmp", "site/dir/b.tmp", "site/dir/b.tmp/",
+		"site/.git", "site/.git/", "site/.git/config", "site/.git/objects/ab/cd",
+		"site/_private/", "site/_private/secret.txt", "site/dir/_private/x",
+		"site/docs/internal", "site/docs/internal/a.html",
+		"site/logs/2020",
+	}
+	for _, key := range hidden {
+		assert.True(t, hiddenKey(key), key)
+	}
+	visible := []string{
+		"site/", "site/a.txt", "site/tmp/", "site/dir/.gitignore",
+		"site/dir/.git/config", "site/_private", "site/dir/_private",
+		"site/docs/internal.html", "site/dir/docs/internal",
+		"site/logs/2020/a.log", "site/logs/",
+	}
+	for _, key := range visible {
+		assert.False(t, hiddenKey(key), key)
+	}
+}
+
+func TestHiddenEntries(t *testing.T) {
+	defer withHiddenPatterns("*.json,sub/", "")()
+
+	entries := toEntries(sampleListing, "dir/")
+	assert.Equal(t, []string{"a.txt"}, entryNames(entries))
+
+	config.Config.HiddenPatterns = "dir/sub/"
+	entries = toEntries(&s3.ListObjectsV2Output{CommonPrefixes: []*s3.CommonPrefix{
+		{Prefix: aws.String("dir/sub/")}, {Prefix: aws.String("dir/other/")},
+	}}, "dir/")
+	assert.Equal(t, []string{"other/"}, entryNames(entries))
+}
+
+func TestHiddenObjectNotFound(t *testing.T) {
+	defer withHiddenPatterns("*.tmp,_private/", "")()
+
+	for _, path := range []string{"/a.tmp", "/_private/", "/_private/index.html"} {
+		w := httptest.NewRecorder()
+		AwsS3(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func withACMECache(bucket, prefix string) func() {
+	config.Config.S3Bucket = "bucket"
+	config.Config.AcmeCacheS3Bucket = bucket
+	config.Config.AcmeCacheS3Prefix = prefix
+	return func() {
+		config.Config.S3Bucket = ""
+		config.Config.AcmeCacheS3Bucket = ""
+		config.Config.AcmeCacheS3Prefix = ""
+	}
+}
+
+func TestACMECacheKey(t *testing.T) {
+	defer withACMECache("bucket", "/acme/")()
+
+	for _, key := range []string{"acme", "acme/", "/acme/acme_account+key", "//acme/example.com", "acme/x/../example.com"} {
+		assert.True(t, acmeCacheKey("bucket", key), key)
+		assert.True(t, hiddenKey(key), key)
+	}
+	for _, key := range []string{"acmefoo", "site/acme/example.com", "/"} {
+		assert.False(t, acmeCacheKey("bucket", key), key)
+	}
+	assert.False(t, acmeCacheKey("other-bucket", "acme/example.com"))
+
+	config.Config.AcmeCacheS3Bucket = "certificates"
+	assert.False(t, hiddenKey("acme/example.com"))
+}
+
+func TestACMECacheNotServed(t *testing.T) {
+	defer withACMECache("bucket", "acme")()
+
+	for _, path := range []string{"/acme/example.com", "/acme/acme_account+key", "/acme/"} {
+		w := httptest.NewRecorder()
+		AwsS3(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+	entries := toEntries(&s3.ListObjectsV2Output{
+		CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String("acme/")}, {Prefix: aws.String("docs/")}},
+		Contents:       []*s3.Object{{Key: aws.String("acme")}, {Key: aws.String("index.html")}},
+	}, "")
+	assert.Equal(t, []string{"docs/", "index.html"}, entryNames(entries))
+}
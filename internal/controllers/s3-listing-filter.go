@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// listingFilter returns a predicate on entry names for ?glob= and ?q=
+func listingFilter(r *http.Request) (func(name string) bool, error) {
+	query := r.URL.Query()
+	glob := query.Get("glob")
+	if len(glob) > 0 {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob: %s", glob)
+		}
+	}
+	substr := strings.ToLower(query.Get("q"))
+
+	return func(name string) bool {
+		name = strings.TrimSuffix(name, "/")
+		if len(glob) > 0 {
+			// Patterns without a slash match the base names in recursive listings
+			target := name
+			if !strings.Contains(glob, "/") {
+				target = path.Base(name)
+			}
+			if matched, _ := path.Match(glob, target); !matched {
+				return false
+			}
+		}
+		return len(substr) == 0 || strings.Contains(strings.ToLower(name), substr)
+	}, nil
+}
+
+// Filtered listings and feeds walk up to this many pages of S3 per request,
+// and continue from there on the next page
+const maxWalkedPages = 10
+
+// listingFiltered reports whether the listing is filtered or sorted,
+// which applies to the whole directory rather than a page of it
+func listingFiltered(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, name := range []string{"glob", "q", "sort", "order"} {
+		if len(query.Get(name)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// listingOrder returns the order of entries for ?sort= and ?order=
+func listingOrder(r *http.Request) (func(a, b listingEntry) bool, error) {
+	query := r.URL.Query()
+	var less func(a, b listingEntry) bool
+	switch query.Get("sort") {
+	case "", "name":
+		less = func(a, b listingEntry) bool { return s3objects{a.Name, b.Name}.Less(0, 1) }
+	case "size":
+		less = func(a, b listingEntry) bool { return aws.Int64Value(a.Size) < aws.Int64Value(b.Size) }
+	case "modified":
+		less = func(a, b listingEntry) bool {
+			return aws.TimeValue(a.LastModified).Before(aws.TimeValue(b.LastModified))
+		}
+	default:
+		return nil, errors.New("sort must be one of name, size or modified")
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		asc := less
+		less = func(a, b listingEntry) bool { return asc(b, a) }
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+	return less, nil
+}
+
+// sortEntries sorts the entries in the order. Directories have neither size
+// nor modification time, so they stay first.
+func sortEntries(entries []listingEntry, less func(a, b listingEntry) bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if dirI, dirJ := entries[i].Type == entryTypeDir, entries[j].Type == entryTypeDir; dirI != dirJ {
+			return dirI
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+// filterEntries applies ?glob=, ?q=, ?sort= and ?order= to the entries,
+// which are already sorted by their names
+func filterEntries(r *http.Request, entries []listingEntry) ([]listingEntry, error) {
+	match, err := listingFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	less, err := listingOrder(r)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []listingEntry{}
+	for _, entry := range entries {
+		if match(entry.Name) {
+			filtered = append(filtered, entry)
+		}
+	}
+	sortEntries(filtered, less)
+	return filtered, nil
+}
+
+// s3listFiltered filters and sorts up to maxWalkedPages pages of the directory
+// at a time. With ?limit=, only as many entries as the limit are kept in order
+// while walking.
+func s3listFiltered(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, prefix string, limit int64, continuation *string) {
+	match, err := listingFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	less, err := listingOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keep := func(entry listingEntry) bool { return match(entry.Name) }
+	entries, result, err := walkEntries(client, bucket, prefix, continuation, keep, less, limit)
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
+	}
+	if limit > 0 {
+		result.MaxKeys = aws.Int64(limit)
+	}
+	writeEntries(w, r, client, result, prefix, entries)
+}
+
+// walkEntries returns the entries to keep in the order, on up to maxWalkedPages
+// pages of the directory from the continuation. With a limit, only as many
+// entries are kept while walking. The result tells whether any have been
+// dropped, and the continuation of the pages left, if any.
+func walkEntries(client service.AWS, bucket, prefix string, continuation *string, keep func(entry listingEntry) bool,
+	less func(a, b listingEntry) bool, limit int64) ([]listingEntry, *s3.ListObjectsV2Output, error) {
+	result := &s3.ListObjectsV2Output{Prefix: aws.String(prefix), IsTruncated: aws.Bool(false)}
+	truncate := func(entries []listingEntry) []listingEntry {
+		sortEntries(entries, less)
+		if limit > 0 && int64(len(entries)) > limit {
+			result.IsTruncated = aws.Bool(true)
+			return entries[:limit]
+		}
+		return entries
+	}
+	entries := []listingEntry{}
+	token := continuation
+	for pages := 0; pages < maxWalkedPages; pages++ {
+		// A page size keeps GET_ALL_PAGES_IN_DIR from listing everything at once
+		page, err := client.S3listObjects(bucket, prefix, maxListingLimit, token)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range toEntries(page, prefix) {
+			if keep(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		if limit > 0 && int64(len(entries)) >= 2*limit {
+			entries = truncate(entries)
+		}
+		if token = page.NextContinuationToken; len(aws.StringValue(token)) == 0 {
+			return truncate(entries), result, nil
+		}
+	}
+	result.IsTruncated = aws.Bool(true)
+	result.NextContinuationToken = token
+	return truncate(entries), result, nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+var filterSamples = []listingEntry{
+	{Name: "nightly/", Type: entryTypeDir},
+	{Name: "build-1.tar.gz", Type: entryTypeFile, Size: aws.Int64(300),
+		LastModified: aws.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))},
+	{Name: "build-2.tar.gz", Type: entryTypeFile, Size: aws.Int64(100),
+		LastModified: aws.Time(time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC))},
+	{Name: "README.md", Type: entryTypeFile, Size: aws.Int64(200),
+		LastModified: aws.Time(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))},
+}
+
+func filteredNames(t *testing.T, query string) []string {
+	entries, err := filterEntries(httptest.NewRequest(http.MethodGet, "/dir/?"+query, nil), filterSamples)
+	assert.Nil(t, err)
+	return entryNames(entries)
+}
+
+func TestFilterEntries(t *testing.T) {
+	assert.Equal(t, []string{"nightly/", "build-1.tar.gz", "build-2.tar.gz", "README.md"}, filteredNames(t, ""))
+	assert.Equal(t, []string{"nightly/", "README.md", "build-2.tar.gz", "build-1.tar.gz"}, filteredNames(t, "order=desc"))
+	assert.Equal(t, []string{"nightly/", "build-2.tar.gz", "README.md", "build-1.tar.gz"}, filteredNames(t, "sort=size"))
+	assert.Equal(t, []string{"nightly/", "build-2.tar.gz", "README.md", "build-1.tar.gz"}, filteredNames(t, "sort=modified&order=desc"))
+	assert.Equal(t, []string{"build-1.tar.gz", "build-2.tar.gz"}, filteredNames(t, "glob=*.tar.gz"))
+	assert.Equal(t, []string{"nightly/"}, filteredNames(t, "glob=night*"))
+	assert.Equal(t, []string{"README.md"}, filteredNames(t, "q=readme"))
+	assert.Equal(t, []string{"build-2.tar.gz"}, filteredNames(t, "glob=build-*&q=2"))
+}
+
+func TestFilterEntriesErrors(t *testing.T) {
+	for _, query := range []string{"glob=[", "sort=owner", "order=up"} {
+		_, err := filterEntries(httptest.NewRequest(http.MethodGet, "/dir/?"+query, nil), filterSamples)
+		assert.NotNil(t, err, query)
+	}
+}
+
+func filteredPages() *fakeS3 {
+	client := &fakeS3{}
+	for i := 0; i < 3; i++ {
+		client.pages = append(client.pages, &s3.ListObjectsV2Output{
+			CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String(fmt.Sprintf("dir/sub-%d/", i))}},
+			Contents: []*s3.Object{
+				{Key: aws.String(fmt.Sprintf("dir/build-%d.tar.gz", i)), Size: aws.Int64(int64(300 - i))},
+				{Key: aws.String(fmt.Sprintf("dir/notes-%d.md", i)), Size: aws.Int64(int64(100 + i))},
+			},
+		})
+	}
+	return client
+}
+
+func TestListFilteredPages(t *testing.T) {
+	for query, expected := range map[string]string{
+		"glob=*.gz":                              `["build-0.tar.gz","build-1.tar.gz","build-2.tar.gz"]`,
+		"q=notes&order=desc":                     `["notes-2.md","notes-1.md","notes-0.md"]`,
+		"sort=size":                              `["sub-0/","sub-1/","sub-2/","notes-0.md","notes-1.md","notes-2.md","build-2.tar.gz","build-1.tar.gz","build-0.tar.gz"]`,
+		"sort=modified&limit=1":                  `["sub-0/"]`,
+		"glob=*.gz&sort=size&limit=2":            `["build-2.tar.gz","build-1.tar.gz"]`,
+		"glob=*.md&sort=size&order=desc&limit=2": `["notes-2.md","notes-1.md"]`,
+	} {
+		w := httptest.NewRecorder()
+		s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?"+query, nil), filteredPages(), "bucket", "/dir/")
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		assert.Equal(t, expected+"\n", w.Body.String(), query)
+		assert.Empty(t, w.Header().Get("Link"), query)
+	}
+}
+
+func TestListFilteredPagesAtATime(t *testing.T) {
+	client := &fakeS3{}
+	for i := 0; i < maxWalkedPages+2; i++ {
+		client.pages = append(client.pages, &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{{Key: aws.String(fmt.Sprintf("dir/f-%02d.txt", i))}},
+		})
+	}
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?order=desc&limit=3", nil), client, "bucket", "/dir/")
+	assert.Equal(t, `["f-09.txt","f-08.txt","f-07.txt"]`+"\n", w.Body.String())
+	assert.Equal(t, "10", w.Header().Get("X-Next-Continuation-Token"))
+	assert.Equal(t, `</dir/?continuation=10&limit=3&order=desc>; rel="next"`, w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?order=desc&limit=3&continuation=10", nil), client, "bucket", "/dir/")
+	assert.Equal(t, `["f-11.txt","f-10.txt"]`+"\n", w.Body.String())
+	assert.Empty(t, w.Header().Get("Link"))
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// Listing formats
+const (
+	formatJSON = "json"
+	formatHTML = "html"
+	formatXML  = "xml"
+	formatText = "text"
+	formatAtom = "atom"
+	formatRSS  = "rss"
+)
+
+// Media types of the listing formats in Accept
+var listingMediaTypes = map[string]string{
+	"application/json":     formatJSON,
+	"text/html":            formatHTML,
+	"application/xml":      formatXML,
+	"text/xml":             formatXML,
+	"text/plain":           formatText,
+	"application/atom+xml": formatAtom,
+	"application/rss+xml":  formatRSS,
+}
+
+// Number of the newest objects in feeds
+const feedSize = 20
+
+// listingFormat returns the format in ?format=, the one preferred in Accept,
+// or DIRECTORY_LISTINGS_FORMAT, which defaults to JSON
+func listingFormat(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); len(format) > 0 {
+		for _, supported := range listingMediaTypes {
+			if format == supported {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+	fallback := strings.ToLower(config.Config.DirListingFormat)
+	if len(fallback) == 0 {
+		fallback = formatJSON
+	}
+	best, bestQ := fallback, 0.0
+	for _, element := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(element))
+		if err != nil {
+			continue
+		}
+		format, ok := listingMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		// The configured format wins a tie
+		if q > bestQ || (q == bestQ && format == fallback) {
+			best, bestQ = format, q
+		}
+	}
+	return best, nil
+}
+
+// listBucketResult is the response of S3 ListObjectsV2
+type listBucketResult struct {
+	XMLName               xml.Name          `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	KeyCount              int               `xml:"KeyCount"`
+	MaxKeys               int64             `xml:"MaxKeys"`
+	Delimiter             string            `xml:"Delimiter"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	ContinuationToken     string            `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	Contents              []xmlObject       `xml:"Contents"`
+	CommonPrefixes        []xmlCommonPrefix `xml:"CommonPrefixes"`
+}
+
+type xmlObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type xmlCommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// toXML returns the entries as S3 would list them, with keys relative to AWS_S3_KEY_PREFIX
+func toXML(r *http.Request, s3output *s3.ListObjectsV2Output, prefix string, entries []listingEntry) ([]byte, error) {
+	prefix = strings.TrimPrefix(prefix, strings.TrimPrefix(config.Config.S3KeyPrefix, "/"))
+	result := listBucketResult{
+		Name:                  config.Config.S3Bucket,
+		Prefix:                prefix,
+		KeyCount:              len(entries),
+		MaxKeys:               aws.Int64Value(s3output.MaxKeys),
+		Delimiter:             "/",
+		IsTruncated:           aws.BoolValue(s3output.IsTruncated),
+		ContinuationToken:     r.URL.Query().Get("continuation"),
+		NextContinuationToken: aws.StringValue(s3output.NextContinuationToken),
+	}
+	for _, entry := range entries {
+		if entry.Type == entryTypeDir {
+			result.CommonPrefixes = append(result.CommonPrefixes, xmlCommonPrefix{Prefix: prefix + entry.Name})
+			continue
+		}
+		result.Contents = append(result.Contents, xmlObject{
+			Key:          prefix + entry.Name,
+			LastModified: aws.TimeValue(entry.LastModified).UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + entry.ETag + `"`,
+			Size:         aws.Int64Value(entry.Size),
+			StorageClass: entry.StorageClass,
+		})
+	}
+	body, err := xml.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// toText returns the names of the entries, one per line
+func toText(entries []listingEntry) []byte {
+	text := new(bytes.Buffer)
+	for _, name := range entryNames(entries) {
+		text.WriteString(name)
+		text.WriteByte('\n')
+	}
+	return text.Bytes()
+}
+
+// s3listFeed walks up to maxWalkedPages pages of the directory from the
+// continuation for the newest files in them, regardless of ?limit=
+func s3listFeed(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, prefix string, continuation *string) {
+	match, err := listingFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keep := func(entry listingEntry) bool { return entry.Type == entryTypeFile && match(entry.Name) }
+	newer := func(a, b listingEntry) bool {
+		return aws.TimeValue(a.LastModified).After(aws.TimeValue(b.LastModified))
+	}
+	entries, result, err := walkEntries(client, bucket, prefix, continuation, keep, newer, feedSize)
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
+	}
+	writeEntries(w, r, client, result, prefix, entries)
+}
+
+// newestFiles returns up to feedSize files, the newest first
+func newestFiles(entries []listingEntry) []listingEntry {
+	files := []listingEntry{}
+	for _, entry := range entries {
+		if entry.Type == entryTypeFile {
+			files = append(files, entry)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return aws.TimeValue(files[i].LastModified).After(aws.TimeValue(files[j].LastModified))
+	})
+	if len(files) > feedSize {
+		files = files[:feedSize]
+	}
+	return files
+}
+
+// baseURL returns the absolute URL of the listing
+func baseURL(r *http.Request) *url.URL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+}
+
+func entryAbsoluteURL(base *url.URL, name string) string {
+	ref, err := url.Parse(entryURL(name))
+	if err != nil {
+		return base.String()
+	}
+	return base.ResolveReference(ref).String()
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+// toAtom returns an Atom feed of the newest files
+func toAtom(r *http.Request, entries []listingEntry) ([]byte, error) {
+	base := baseURL(r)
+	feed := atomFeed{
+		Title: "Index of " + r.URL.Path,
+		ID:    base.String(),
+		Link:  atomLink{Href: base.String(), Rel: "alternate"},
+	}
+	updated := time.Time{}
+	for _, file := range newestFiles(entries) {
+		modified := aws.TimeValue(file.LastModified)
+		if modified.After(updated) {
+			updated = modified
+		}
+		link := entryAbsoluteURL(base, file.Name)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title: file.Name,
+			// A file uploaded again is a new entry
+			ID:      link + "#" + file.ETag,
+			Updated: modified.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: link},
+			Summary: humanSize(file.Size),
+		})
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// toRSS returns a RSS 2.0 feed of the newest files
+func toRSS(r *http.Request, entries []listingEntry) ([]byte, error) {
+	base := baseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Index of " + r.URL.Path,
+			Link:        base.String(),
+			Description: "The newest files in " + r.URL.Path,
+		},
+	}
+	for _, file := range newestFiles(entries) {
+		link := entryAbsoluteURL(base, file.Name)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       file.Name,
+			Link:        link,
+			GUID:        rssGUID{Value: link + "#" + file.ETag},
+			PubDate:     aws.TimeValue(file.LastModified).UTC().Format(time.RFC1123Z),
+			Description: humanSize(file.Size),
+		})
+	}
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
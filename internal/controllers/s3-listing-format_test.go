@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func formatOf(t *testing.T, query, accept string) string {
+	req := httptest.NewRequest(http.MethodGet, "/dir/"+query, nil)
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+	format, err := listingFormat(req)
+	assert.Nil(t, err)
+	return format
+}
+
+func TestListingFormat(t *testing.T) {
+	assert.Equal(t, formatJSON, formatOf(t, "", ""))
+	assert.Equal(t, formatJSON, formatOf(t, "", "*/*"))
+	assert.Equal(t, formatHTML, formatOf(t, "", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"))
+	assert.Equal(t, formatAtom, formatOf(t, "", "application/atom+xml"))
+	assert.Equal(t, formatText, formatOf(t, "?format=TEXT", "text/html"))
+
+	config.Config.DirListingFormat = "html"
+	defer func() { config.Config.DirListingFormat = "" }()
+	assert.Equal(t, formatHTML, formatOf(t, "", ""))
+	assert.Equal(t, formatHTML, formatOf(t, "", "application/json, text/html"))
+	assert.Equal(t, formatXML, formatOf(t, "", "text/xml"))
+
+	_, err := listingFormat(httptest.NewRequest(http.MethodGet, "/dir/?format=yaml", nil))
+	assert.NotNil(t, err)
+}
+
+func listWithFormat(format string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/dir/?format="+format, nil)
+	s3listFiles(w, req, &fakeS3{listing: sampleListing}, "bucket", "/dir/")
+	return w
+}
+
+func TestListFilesAsXML(t *testing.T) {
+	w := listWithFormat(formatXML)
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+
+	result := struct {
+		Prefix         string
+		IsTruncated    bool
+		Contents       []struct{ Key, ETag string }
+		CommonPrefixes []struct{ Prefix string }
+	}{}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "dir/", result.Prefix)
+	assert.True(t, result.IsTruncated)
+	assert.Equal(t, "dir/a.txt", result.Contents[0].Key)
+	assert.Equal(t, `"d41d8cd98f00b204e9800998ecf8427e"`, result.Contents[1].ETag)
+	assert.Equal(t, "dir/sub/", result.CommonPrefixes[0].Prefix)
+}
+
+func TestListFilesAsText(t *testing.T) {
+	w := listWithFormat(formatText)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "sub/\na.txt\nb.json\n", w.Body.String())
+}
+
+func TestListFilesAsFeeds(t *testing.T) {
+	w := listWithFormat(formatAtom)
+	assert.Equal(t, "application/atom+xml", w.Header().Get("Content-Type"))
+	feed := struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Title string `xml:"title"`
+			Link  struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}{}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, "2020-01-02T03:04:05Z", feed.Updated)
+	assert.Equal(t, 2, len(feed.Entries))
+	assert.Equal(t, "b.json", feed.Entries[0].Title)
+	assert.Equal(t, "http://example.com/dir/b.json", feed.Entries[0].Link.Href)
+
+	w = listWithFormat(formatRSS)
+	assert.Equal(t, "application/rss+xml", w.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(w.Body.String(), "<pubDate>Thu, 02 Jan 2020 03:04:05 +0000</pubDate>"))
+	assert.True(t, strings.Contains(w.Body.String(), `<guid isPermaLink="false">http://example.com/dir/b.json#d41d8cd98f00b204e9800998ecf8427e</guid>`))
+}
+
+func TestFeedsOfEveryPage(t *testing.T) {
+	client := &fakeS3{}
+	for i := 0; i < 3; i++ {
+		page := &s3.ListObjectsV2Output{}
+		for j := 0; j < 10; j++ {
+			n := j*3 + i
+			page.Contents = append(page.Contents, &s3.Object{
+				Key:          aws.String(fmt.Sprintf("dir/%02d.txt", n)),
+				LastModified: aws.Time(time.Date(2020, 1, 1, 0, n, 0, 0, time.UTC)),
+			})
+		}
+		client.pages = append(client.pages, page)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/dir/?format=rss&limit=5", nil)
+	s3listFiles(w, req, client, "bucket", "/dir/")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	feed := struct {
+		Titles []string `xml:"channel>item>title"`
+	}{}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	expected := []string{}
+	for n := 29; n >= 10; n-- {
+		expected = append(expected, fmt.Sprintf("%02d.txt", n))
+	}
+	assert.Equal(t, expected, feed.Titles)
+}
+
+func TestFeedsPagesAtATime(t *testing.T) {
+	client := &fakeS3{}
+	for i := 0; i < maxWalkedPages+1; i++ {
+		client.pages = append(client.pages, &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{{Key: aws.String(fmt.Sprintf("dir/%02d.txt", i)),
+				LastModified: aws.Time(time.Date(2020, 1, 1, 0, i, 0, 0, time.UTC))}},
+		})
+	}
+	feed := struct {
+		Titles []string `xml:"channel>item>title"`
+	}{}
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "http://example.com/dir/?format=rss", nil), client, "bucket", "/dir/")
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, maxWalkedPages, len(feed.Titles))
+	assert.Equal(t, "09.txt", feed.Titles[0])
+	assert.Equal(t, "10", w.Header().Get("X-Next-Continuation-Token"))
+
+	feed.Titles = nil
+	w = httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "http://example.com/dir/?format=rss&continuation=10", nil), client, "bucket", "/dir/")
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal(t, []string{"10.txt"}, feed.Titles)
+}
+
+func TestNewestFiles(t *testing.T) {
+	entries := toEntries(&s3.ListObjectsV2Output{Contents: sampleListing.Contents}, "dir/")
+	assert.Equal(t, []string{"b.json", "a.txt"}, entryNames(newestFiles(entries)))
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// How long a custom listing template is used before it is loaded again
+const listingTemplateTTL = time.Minute
+
+// htmlListing is passed to the listing template
+type htmlListing struct {
+	Path        string
+	Breadcrumbs []breadcrumb
+	Parent      string
+	Entries     []listingEntry
+	Next        string
+}
+
+type breadcrumb struct {
+	Name string
+	URL  string
+}
+
+var listingFuncs = template.FuncMap{
+	"href": entryURL,
+	"size": humanSize,
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02 15:04")
+	},
+	"datetime": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+	"bytes": func(size *int64) int64 {
+		return aws.Int64Value(size)
+	},
+}
+
+var defaultListingTemplate = template.Must(template.New("listing").Funcs(listingFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th { cursor: pointer; text-align: left; }
+th, td { padding: 2px 12px; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{range $i, $b := .Breadcrumbs}}{{if $i}} / {{end}}<a href="{{$b.URL}}">{{$b.Name}}</a>{{end}}</h1>
+<table>
+<thead><tr><th data-type="text">Name</th><th data-type="number">Size</th><th data-type="text">Last modified</th></tr></thead>
+<tbody>
+{{- if .Parent}}
+<tr><td><a href="{{.Parent}}">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td data-value="{{.Name}}"><a href="{{href .Name}}">{{.Name}}</a></td>
+<td class="size" data-value="{{bytes .Size}}">{{size .Size}}</td>
+<td data-value="{{datetime .LastModified}}">{{with .LastModified}}<time datetime="{{datetime .}}">{{date .}}</time>{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .Next}}
+<p><a href="{{.Next}}">next page</a></p>
+{{- end}}
+<script>
+document.querySelectorAll("th").forEach(function (th, col) {
+  th.addEventListener("click", function () {
+    var tbody = th.closest("table").tBodies[0];
+    var asc = th.dataset.order !== "asc";
+    var rows = Array.prototype.filter.call(tbody.rows, function (row) { return row.cells[col].dataset.value !== undefined; });
+    rows.sort(function (a, b) {
+      var x = a.cells[col].dataset.value, y = b.cells[col].dataset.value;
+      var c = th.dataset.type === "number" ? x - y : x.localeCompare(y);
+      return asc ? c : -c;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+    th.dataset.order = asc ? "asc" : "desc";
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+var listingTemplate struct {
+	sync.Mutex
+	tmpl     *template.Template
+	loadedAt time.Time
+}
+
+// getListingTemplate returns the template in DIRECTORY_LISTINGS_TEMPLATE_S3_KEY or
+// DIRECTORY_LISTINGS_TEMPLATE, or the default one. When a custom template
+// cannot be loaded, the last one loaded successfully is used.
+func getListingTemplate(client service.AWS) *template.Template {
+	c := config.Config
+	if len(c.DirListingTemplateS3Key) == 0 && len(c.DirListingTemplate) == 0 {
+		return defaultListingTemplate
+	}
+	listingTemplate.Lock()
+	defer listingTemplate.Unlock()
+
+	if listingTemplate.tmpl != nil && time.Since(listingTemplate.loadedAt) < listingTemplateTTL {
+		return listingTemplate.tmpl
+	}
+	listingTemplate.loadedAt = time.Now()
+
+	tmpl, err := loadListingTemplate(client)
+	if err != nil {
+		log.Printf("[listing] template: %v", err)
+		if listingTemplate.tmpl == nil {
+			return defaultListingTemplate
+		}
+		return listingTemplate.tmpl
+	}
+	listingTemplate.tmpl = tmpl
+	return tmpl
+}
+
+func loadListingTemplate(client service.AWS) (*template.Template, error) {
+	c := config.Config
+	var data []byte
+	if len(c.DirListingTemplateS3Key) > 0 {
+		obj, err := client.S3get(c.S3Bucket, c.DirListingTemplateS3Key, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer obj.Body.Close()
+		if data, err = ioutil.ReadAll(obj.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = ioutil.ReadFile(c.DirListingTemplate); err != nil {
+			return nil, err
+		}
+	}
+	return template.New("listing").Funcs(listingFuncs).Parse(string(data))
+}
+
+func toHTML(client service.AWS, path string, entries []listingEntry, next string) ([]byte, error) {
+	crumbs, parent := breadcrumbs(path)
+	buf := new(bytes.Buffer)
+	err := getListingTemplate(client).Execute(buf, htmlListing{
+		Path:        path,
+		Breadcrumbs: crumbs,
+		Parent:      parent,
+		Entries:     entries,
+		Next:        next,
+	})
+	return buf.Bytes(), err
+}
+
+// breadcrumbs splits the requested path below STRIP_PATH into links to each
+// of its ancestors, and returns the link to the parent directory if any
+func breadcrumbs(path string) ([]breadcrumb, string) {
+	base := strings.TrimSuffix(config.Config.StripPath, "/")
+	crumbs := []breadcrumb{{Name: "/", URL: base + "/"}}
+
+	current := base + "/"
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, base), "/"), "/")
+	for _, segment := range segments {
+		if len(segment) == 0 {
+			continue
+		}
+		current += url.PathEscape(segment) + "/"
+		crumbs = append(crumbs, breadcrumb{Name: segment, URL: current})
+	}
+	if len(crumbs) == 1 {
+		return crumbs, ""
+	}
+	return crumbs, crumbs[len(crumbs)-2].URL
+}
+
+// entryURL returns the link to the entry relative to the listing
+func entryURL(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	// Keep names like "a:b" from being taken as a scheme
+	return "./" + strings.Join(segments, "/")
+}
+
+// humanSize formats the size in binary units, e.g. 1.5 KiB
+func humanSize(size *int64) string {
+	if size == nil {
+		return ""
+	}
+	const unit = 1024
+	value := *size
+	if value < unit {
+		return fmt.Sprintf("%d B", value)
+	}
+	div, exp := int64(unit), 0
+	for n := value / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(value)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHTMLEscapesNames(t *testing.T) {
+	entries := []listingEntry{
+		{Name: "<script>alert(1)</script>.txt", Type: entryTypeFile, Size: aws.Int64(1536),
+			LastModified: aws.Time(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))},
+		{Name: "a b#c/", Type: entryTypeDir},
+	}
+	html, err := toHTML(&fakeS3{}, "/dir/sub/", entries, "")
+	assert.Nil(t, err)
+
+	body := string(html)
+	assert.False(t, strings.Contains(body, "<script>alert"))
+	assert.True(t, strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;.txt"))
+	assert.True(t, strings.Contains(body, `href="./a%20b%23c/"`))
+	assert.True(t, strings.Contains(body, "1.5 KiB"))
+	assert.True(t, strings.Contains(body, `<time datetime="2020-01-02T03:04:05Z">2020-01-02 03:04</time>`))
+	assert.True(t, strings.Contains(body, `<a href="/dir/">../</a>`))
+	assert.True(t, strings.Contains(body, `<a href="/">/</a> / <a href="/dir/">dir</a> / <a href="/dir/sub/">sub</a>`))
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	crumbs, parent := breadcrumbs("/")
+	assert.Equal(t, []breadcrumb{{Name: "/", URL: "/"}}, crumbs)
+	assert.Equal(t, "", parent)
+
+	config.Config.StripPath = "/static/"
+	defer func() { config.Config.StripPath = "" }()
+
+	crumbs, parent = breadcrumbs("/static/a/")
+	assert.Equal(t, []breadcrumb{{Name: "/", URL: "/static/"}, {Name: "a", URL: "/static/a/"}}, crumbs)
+	assert.Equal(t, "/static/", parent)
+
+	crumbs, parent = breadcrumbs("/static/50%/a#b?/")
+	assert.Equal(t, []breadcrumb{{Name: "/", URL: "/static/"}, {Name: "50%", URL: "/static/50%25/"},
+		{Name: "a#b?", URL: "/static/50%25/a%23b%3F/"}}, crumbs)
+	assert.Equal(t, "/static/50%25/", parent)
+}
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "", humanSize(nil))
+	assert.Equal(t, "0 B", humanSize(aws.Int64(0)))
+	assert.Equal(t, "1023 B", humanSize(aws.Int64(1023)))
+	assert.Equal(t, "1.0 KiB", humanSize(aws.Int64(1024)))
+	assert.Equal(t, "2.5 MiB", humanSize(aws.Int64(2621440)))
+	assert.Equal(t, "1.0 GiB", humanSize(aws.Int64(1<<30)))
+}
+
+func TestCustomListingTemplate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "template")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "listing.html")
+	ioutil.WriteFile(path, []byte(`{{range .Entries}}[{{.Name}}]{{end}}`), 0600) // nolint
+
+	c := config.Config
+	c.DirListingTemplate = path
+	defer func() {
+		c.DirListingTemplate = ""
+		c.DirListingTemplateS3Key = ""
+		listingTemplate.tmpl = nil
+	}()
+	entries := []listingEntry{{Name: "a<b", Type: entryTypeFile}}
+
+	html, err := toHTML(&fakeS3{}, "/", entries, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "[a&lt;b]", string(html))
+
+	// From S3, once the cached one expires
+	c.DirListingTemplateS3Key = "templates/listing.html"
+	listingTemplate.loadedAt = time.Time{}
+	client := &fakeS3{objects: map[string]string{"templates/listing.html": `{{len .Entries}}`}}
+	html, err = toHTML(client, "/", entries, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(html))
+
+	// A broken one is ignored
+	listingTemplate.loadedAt = time.Time{}
+	client.objects["templates/listing.html"] = `{{`
+	html, _ = toHTML(client, "/", entries, "")
+	assert.Equal(t, "1", string(html))
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// S3 returns 1000 keys at most per request
+const maxListingLimit = 1000
+
+// listingPage returns the page size and the continuation token in
+// ?limit= and ?continuation=. A zero limit means S3's default.
+func listingPage(r *http.Request) (int64, *string, error) {
+	query := r.URL.Query()
+	var limit int64
+	if value := query.Get("limit"); len(value) > 0 {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxListingLimit {
+			return 0, nil, fmt.Errorf("limit must be between 1 and %d", maxListingLimit)
+		}
+		limit = parsed
+	}
+	var continuation *string
+	if value := query.Get("continuation"); len(value) > 0 {
+		continuation = aws.String(value)
+	}
+	return limit, continuation, nil
+}
+
+// nextPageURL returns the URL of the next page relative to the host,
+// or an empty string on the last page
+func nextPageURL(r *http.Request, token *string) string {
+	if len(aws.StringValue(token)) == 0 {
+		return ""
+	}
+	query := r.URL.Query()
+	query.Set("continuation", *token)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return next.String()
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListingPage(t *testing.T) {
+	limit, continuation, err := listingPage(httptest.NewRequest(http.MethodGet, "/dir/", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), limit)
+	assert.Nil(t, continuation)
+
+	limit, continuation, err = listingPage(httptest.NewRequest(http.MethodGet, "/dir/?limit=10&continuation=abc%2B", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), limit)
+	assert.Equal(t, "abc+", aws.StringValue(continuation))
+
+	for _, limit := range []string{"0", "1001", "ten"} {
+		_, _, err = listingPage(httptest.NewRequest(http.MethodGet, "/dir/?limit="+limit, nil))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/dir/?limit=10&continuation=old", nil)
+	assert.Equal(t, "", nextPageURL(req, nil))
+	assert.Equal(t, "/dir/?continuation=a%2Bb&limit=10", nextPageURL(req, aws.String("a+b")))
+}
+
+func TestListFilesWithNextPage(t *testing.T) {
+	client := &fakeS3{listing: &s3.ListObjectsV2Output{
+		Contents: []*s3.Object{
+			{Key: aws.String("dir/a.txt"), LastModified: aws.Time(time.Unix(0, 0))},
+		},
+		NextContinuationToken: aws.String("token"),
+	}}
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?limit=1", nil), client, "bucket", "/dir/")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[\"a.txt\"]\n", w.Body.String())
+	assert.Equal(t, "token", w.Header().Get("X-Next-Continuation-Token"))
+	assert.Equal(t, `</dir/?continuation=token&limit=1>; rel="next"`, w.Header().Get("Link"))
+
+	config.Config.DirListingFormat = "html"
+	defer func() { config.Config.DirListingFormat = "" }()
+	w = httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?limit=1", nil), client, "bucket", "/dir/")
+	assert.True(t, strings.Contains(w.Body.String(), `<a href="/dir/?continuation=token&amp;limit=1">next page</a>`))
+
+	w = httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?limit=-1", nil), client, "bucket", "/dir/")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
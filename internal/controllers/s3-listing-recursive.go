@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// s3listRecursive streams every object under the prefix as newline-delimited
+// JSON, one page at a time, so that memory use does not grow with the prefix
+func s3listRecursive(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, prefix string) {
+	match, err := listingFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	started := false
+	encoder := json.NewEncoder(w)
+
+	err = client.S3walkObjects(bucket, prefix, func(page *s3.ListObjectsV2Output) bool {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			if len(name) == 0 || !match(name) || hiddenKey(aws.StringValue(obj.Key)) {
+				continue
+			}
+			if err := encoder.Encode(fileEntry(obj, name)); err != nil {
+				return false
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return r.Context().Err() == nil
+	})
+	if err != nil {
+		if started {
+			log.Printf("[listing] %s: %v", prefix, err)
+			return
+		}
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+	}
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRecursive(t *testing.T) {
+	client := &fakeS3{pages: []*s3.ListObjectsV2Output{
+		{Contents: []*s3.Object{
+			{Key: aws.String("dir/")},
+			{Key: aws.String("dir/a.txt"), Size: aws.Int64(1)},
+		}},
+		{Contents: []*s3.Object{
+			{Key: aws.String("dir/sub/b.tar.gz"), Size: aws.Int64(2)},
+		}},
+	}}
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?recursive=true", nil), client, "bucket", "/dir/")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"name":"a.txt","type":"file","size":1,"contentType":"text/plain; charset=utf-8"}`+"\n"+
+		`{"name":"sub/b.tar.gz","type":"file","size":2,"contentType":"application/gzip"}`+"\n", w.Body.String())
+	assert.True(t, w.Flushed)
+
+	w = httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?recursive=1&glob=*.gz", nil), client, "bucket", "/dir/")
+	assert.Equal(t, `{"name":"sub/b.tar.gz","type":"file","size":2,"contentType":"application/gzip"}`+"\n", w.Body.String())
+}
+
+func TestListRecursiveError(t *testing.T) {
+	client := &fakeS3{walkErr: errors.New("AccessDenied")}
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/?recursive=true", nil), client, "bucket", "/dir/")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"mime"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Types of listing entries
+const (
+	entryTypeFile = "file"
+	entryTypeDir  = "dir"
+)
+
+// The version of the JSON listing schema below
+const listingVersion = 2
+
+// listing is the JSON directory listing of DIRECTORY_LISTINGS_JSON_VERSION=2
+type listing struct {
+	Version               int            `json:"version"`
+	Prefix                string         `json:"prefix"`
+	Entries               []listingEntry `json:"entries"`
+	IsTruncated           bool           `json:"isTruncated"`
+	NextContinuationToken string         `json:"nextContinuationToken,omitempty"`
+	Next                  string         `json:"next,omitempty"`
+}
+
+type listingEntry struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	Size         *int64     `json:"size,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	ETag         string     `json:"etag,omitempty"`
+	StorageClass string     `json:"storageClass,omitempty"`
+	ContentType  string     `json:"contentType,omitempty"`
+}
+
+func toListing(s3output *s3.ListObjectsV2Output, prefix string, entries []listingEntry, next string) listing {
+	return listing{
+		Version:               listingVersion,
+		Prefix:                prefix,
+		Entries:               entries,
+		IsTruncated:           aws.BoolValue(s3output.IsTruncated),
+		NextContinuationToken: aws.StringValue(s3output.NextContinuationToken),
+		Next:                  next,
+	}
+}
+
+// toEntries returns directories and files under the prefix sorted by their names
+func toEntries(s3output *s3.ListObjectsV2Output, prefix string) []listingEntry {
+	candidates := map[string]listingEntry{}
+
+	// Prefixes
+	for _, obj := range s3output.CommonPrefixes {
+		name := strings.TrimPrefix(aws.StringValue(obj.Prefix), prefix)
+		if len(name) == 0 || hiddenKey(aws.StringValue(obj.Prefix)) {
+			continue
+		}
+		candidates[name] = listingEntry{Name: name, Type: entryTypeDir}
+	}
+	// Contents
+	for _, obj := range s3output.Contents {
+		name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+		if len(name) == 0 || hiddenKey(aws.StringValue(obj.Key)) {
+			continue
+		}
+		candidates[name] = fileEntry(obj, name)
+	}
+	// Sort file names
+	names := []string{}
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Sort(s3objects(names))
+
+	entries := make([]listingEntry, len(names))
+	for i, name := range names {
+		entries[i] = candidates[name]
+	}
+	return entries
+}
+
+func fileEntry(obj *s3.Object, name string) listingEntry {
+	return listingEntry{
+		Name:         name,
+		Type:         entryTypeFile,
+		Size:         aws.Int64(aws.Int64Value(obj.Size)),
+		LastModified: obj.LastModified,
+		ETag:         strings.Trim(aws.StringValue(obj.ETag), `"`),
+		StorageClass: aws.StringValue(obj.StorageClass),
+		ContentType:  mime.TypeByExtension(path.Ext(name)),
+	}
+}
+
+func entryNames(entries []listingEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+	return names
+}
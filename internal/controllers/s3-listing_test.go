@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleListing = &s3.ListObjectsV2Output{
+	CommonPrefixes: []*s3.CommonPrefix{
+		{Prefix: aws.String("dir/sub/")},
+	},
+	Contents: []*s3.Object{
+		{Key: aws.String("dir/")},
+		{
+			Key:          aws.String("dir/b.json"),
+			Size:         aws.Int64(0),
+			LastModified: aws.Time(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+			ETag:         aws.String(`"d41d8cd98f00b204e9800998ecf8427e"`),
+			StorageClass: aws.String(s3.ObjectStorageClassStandard),
+		},
+		{
+			Key:          aws.String("dir/a.txt"),
+			Size:         aws.Int64(12),
+			LastModified: aws.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	},
+	IsTruncated:           aws.Bool(true),
+	NextContinuationToken: aws.String("token"),
+}
+
+func TestToEntries(t *testing.T) {
+	entries := toEntries(sampleListing, "dir/")
+
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, listingEntry{Name: "sub/", Type: entryTypeDir}, entries[0])
+	assert.Equal(t, "a.txt", entries[1].Name)
+	assert.Equal(t, int64(12), aws.Int64Value(entries[1].Size))
+
+	b := entries[2]
+	assert.Equal(t, entryTypeFile, b.Type)
+	assert.Equal(t, int64(0), aws.Int64Value(b.Size))
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", b.ETag)
+	assert.Equal(t, "STANDARD", b.StorageClass)
+	assert.Equal(t, "application/json", b.ContentType)
+}
+
+func TestListFilesJSONVersion(t *testing.T) {
+	config.Config.DirListingJSONVersion = 2
+	defer func() { config.Config.DirListingJSONVersion = 1 }()
+
+	w := httptest.NewRecorder()
+	s3listFiles(w, httptest.NewRequest(http.MethodGet, "/dir/", nil), &fakeS3{listing: sampleListing}, "bucket", "/dir/")
+
+	actual := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &actual))
+	assert.Equal(t, float64(2), actual["version"])
+	assert.Equal(t, "dir/", actual["prefix"])
+	assert.Equal(t, true, actual["isTruncated"])
+	assert.Equal(t, "token", actual["nextContinuationToken"])
+	assert.Equal(t, "/dir/?continuation=token", actual["next"])
+
+	entries := actual["entries"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "sub/", "type": "dir"}, entries[0])
+	assert.Equal(t, map[string]interface{}{
+		"name":         "a.txt",
+		"type":         "file",
+		"size":         float64(12),
+		"lastModified": "2020-01-01T00:00:00Z",
+		"contentType":  "text/plain; charset=utf-8",
+	}, entries[1])
+}
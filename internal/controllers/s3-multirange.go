@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// Requests with more ranges than this are served the whole object, as
+// RFC 7233 allows, rather than fanning out to that many S3 requests
+const maxRanges = 16
+
+// splitRanges splits "bytes=0-99,200-299" into "bytes=0-99" and "bytes=200-299".
+// It returns nil unless the header is a valid multi-range request.
+func splitRanges(rangeHeader string) []string {
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return nil
+	}
+	specs := strings.Split(strings.TrimPrefix(rangeHeader, "bytes="), ",")
+	if len(specs) < 2 {
+		return nil
+	}
+	ranges := []string{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if !strings.Contains(spec, "-") {
+			return nil
+		}
+		ranges = append(ranges, "bytes="+spec)
+	}
+	return ranges
+}
+
+// Parts are requested again this many times in all, if the object is
+// overwritten while they are being requested
+const rangeAttempts = 3
+
+// s3multiRange serves a multipart/byteranges response. The first satisfiable
+// part is requested first, and the others concurrently on condition that the
+// object still has its ETag. Their bodies are streamed one after another.
+func s3multiRange(w http.ResponseWriter, client service.AWS, bucket, key string, ranges []string, httpCacheControl, httpExpires string) {
+	var objs []*s3.GetObjectOutput
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		objs, errs = getRanges(client, bucket, key, ranges)
+		if attempt == rangeAttempts || !anyPreconditionFailed(errs) {
+			break
+		}
+		for _, obj := range objs {
+			if obj != nil {
+				obj.Body.Close()
+			}
+		}
+	}
+
+	// Unsatisfiable ranges are ignored as long as any other one is satisfiable,
+	// and any other failure fails the response
+	parts := []*s3.GetObjectOutput{}
+	var failure error
+	for i, err := range errs {
+		switch {
+		case err == nil && objs[i] != nil:
+			parts = append(parts, objs[i])
+		case err != nil && (!isInvalidRange(err) || failure == nil):
+			failure = err
+		}
+	}
+	defer func() {
+		for _, part := range parts {
+			part.Body.Close()
+		}
+	}()
+	if failure != nil && (len(parts) == 0 || !isInvalidRange(failure)) {
+		if isInvalidRange(failure) {
+			if head, err := client.S3head(bucket, key); err == nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", aws.Int64Value(head.ContentLength)))
+			}
+		}
+		code, message := toHTTPError(failure)
+		http.Error(w, message, code)
+		return
+	}
+	setObjectHeaders(w, parts[0], httpCacheControl, httpExpires)
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		if contentType := aws.StringValue(part.ContentType); len(contentType) > 0 {
+			header.Set("Content-Type", contentType)
+		}
+		header.Set("Content-Range", aws.StringValue(part.ContentRange))
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return
+		}
+		if _, err = io.Copy(pw, part.Body); err != nil {
+			return
+		}
+	}
+	mw.Close() // nolint
+}
+
+// getRanges requests the ranges until the first satisfiable one, and the rest
+// of them concurrently on condition that the object still has its ETag.
+// Ranges after the first failure other than an unsatisfiable range are not
+// requested at all.
+func getRanges(client service.AWS, bucket, key string, ranges []string) ([]*s3.GetObjectOutput, []error) {
+	objs := make([]*s3.GetObjectOutput, len(ranges))
+	errs := make([]error, len(ranges))
+
+	first := 0
+	for ; first < len(ranges); first++ {
+		objs[first], errs[first] = client.S3get(bucket, key, aws.String(ranges[first]))
+		if errs[first] == nil || !isInvalidRange(errs[first]) {
+			break
+		}
+	}
+	if first < len(ranges) && errs[first] == nil {
+		// Every part must come from the same version of the object
+		eTag := objs[first].ETag
+		wg := sync.WaitGroup{}
+		for i := first + 1; i < len(ranges); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				objs[i], errs[i] = client.S3getIfMatch(bucket, key, aws.String(ranges[i]), eTag)
+			}(i)
+		}
+		wg.Wait()
+	}
+	return objs, errs
+}
+
+func anyPreconditionFailed(errs []error) bool {
+	for _, err := range errs {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodePreconditionFailed {
+			return true
+		}
+	}
+	return false
+}
+
+func isInvalidRange(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == errCodeInvalidRange
+}
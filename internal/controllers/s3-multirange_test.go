@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRanges(t *testing.T) {
+	assert.Nil(t, splitRanges("bytes=0-99"))
+	assert.Nil(t, splitRanges("items=0-1,2-3"))
+	assert.Nil(t, splitRanges("bytes=0-99,100"))
+	assert.Equal(t, []string{"bytes=0-99", "bytes=200-", "bytes=-50"}, splitRanges("bytes=0-99, 200-,-50"))
+}
+
+func TestS3multiRange(t *testing.T) {
+	client := &fakeS3{
+		objects: map[string]string{"doc.pdf": "0123456789"},
+		types:   map[string]string{"doc.pdf": "application/pdf"},
+	}
+	w := httptest.NewRecorder()
+	s3multiRange(w, client, "bucket", "doc.pdf", []string{"bytes=0-1", "bytes=20-30", "bytes=5-7"}, "", "")
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	part, _ := reader.NextPart()
+	assert.Equal(t, "application/pdf", part.Header.Get("Content-Type"))
+	assert.Equal(t, "bytes 0-1/10", part.Header.Get("Content-Range"))
+	body, _ := ioutil.ReadAll(part)
+	assert.Equal(t, "01", string(body))
+
+	part, _ = reader.NextPart()
+	assert.Equal(t, "bytes 5-7/10", part.Header.Get("Content-Range"))
+	body, _ = ioutil.ReadAll(part)
+	assert.Equal(t, "567", string(body))
+
+	_, err := reader.NextPart()
+	assert.NotNil(t, err)
+}
+
+func TestS3multiRangeErrors(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{"doc.pdf": "0123456789"}}
+
+	w := httptest.NewRecorder()
+	s3multiRange(w, client, "bucket", "doc.pdf", []string{"bytes=20-30", "bytes=40-50"}, "", "")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+
+	w = httptest.NewRecorder()
+	s3multiRange(w, client, "bucket", "missing.pdf", []string{"bytes=0-1", "bytes=2-3"}, "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestS3multiRangeOverwritten(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{"doc.pdf": "0123456789"}}
+	client.onGet = func(key string) {
+		client.objects[key] = "abcdefghij"
+		client.onGet = nil
+	}
+	w := httptest.NewRecorder()
+	s3multiRange(w, client, "bucket", "doc.pdf", []string{"bytes=0-1", "bytes=4-5"}, "", "")
+
+	// Parts of two versions are never mixed, but requested again from the new one
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Contains(t, w.Body.String(), "ab")
+	assert.Contains(t, w.Body.String(), "ef")
+	assert.NotContains(t, w.Body.String(), "45")
+
+	w = httptest.NewRecorder()
+	s3multiRange(w, alwaysOverwritten{client}, "bucket", "doc.pdf", []string{"bytes=0-1", "bytes=4-5"}, "", "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+// alwaysOverwritten has another version of objects for every conditional request
+type alwaysOverwritten struct {
+	*fakeS3
+}
+
+func (a alwaysOverwritten) S3getIfMatch(bucket, key string, rangeHeader, eTag *string) (*s3.GetObjectOutput, error) {
+	return nil, awserr.New(errCodePreconditionFailed, "precondition failed", nil)
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	common "github.com/pottava/aws-s3-proxy/internal/http"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// Suffixes of the precompressed siblings, e.g. app.js.br for app.js
+var precompressedSuffixes = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// s3getPrecompressed fetches the sibling of the key compressed with the
+// content-coding the client prefers. It returns nil if there is none.
+// Only types in CONTENT_ENCODING_TYPES are looked for, so that images and
+// archives do not cost another request.
+func s3getPrecompressed(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, key string, encodings []string) *s3.GetObjectOutput {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if len(contentType) == 0 || !common.Compressible(contentType) {
+		return nil
+	}
+	supported := []string{}
+	for _, encoding := range encodings {
+		if _, ok := precompressedSuffixes[encoding]; ok {
+			supported = append(supported, encoding)
+		}
+	}
+	if len(supported) == 0 {
+		return nil
+	}
+	// Whichever is served, the response depends on Accept-Encoding
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding := common.NegotiateEncoding(r, supported)
+	if len(encoding) == 0 {
+		return nil
+	}
+	obj, err := client.S3get(bucket, key+precompressedSuffixes[encoding], nil)
+	if err != nil {
+		return nil
+	}
+	obj.ContentEncoding = aws.String(encoding)
+	obj.ContentType = aws.String(contentType)
+	return obj
+}
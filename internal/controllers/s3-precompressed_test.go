@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3getPrecompressed(t *testing.T) {
+	client := &fakeS3{
+		objects: map[string]string{"app.js": "plain", "app.js.br": "brotli", "app.js.gz": "gzip"},
+		types:   map[string]string{"app.js.br": "application/x-brotli"},
+	}
+	encodings := []string{"br", "gzip"}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/app.js", nil)
+
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	w := httptest.NewRecorder()
+	obj := s3getPrecompressed(w, req, client, "bucket", "app.js", encodings)
+	body, _ := ioutil.ReadAll(obj.Body)
+	assert.Equal(t, "brotli", string(body))
+	assert.Equal(t, "br", aws.StringValue(obj.ContentEncoding))
+	assert.Contains(t, aws.StringValue(obj.ContentType), "javascript")
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+	req.Header.Set("Accept-Encoding", "gzip, br;q=0")
+	obj = s3getPrecompressed(httptest.NewRecorder(), req, client, "bucket", "app.js", encodings)
+	assert.Equal(t, "gzip", aws.StringValue(obj.ContentEncoding))
+
+	// Not accepted, not configured or not uploaded
+	req.Header.Set("Accept-Encoding", "identity")
+	assert.Nil(t, s3getPrecompressed(httptest.NewRecorder(), req, client, "bucket", "app.js", encodings))
+
+	req.Header.Set("Accept-Encoding", "zstd, deflate")
+	w = httptest.NewRecorder()
+	assert.Nil(t, s3getPrecompressed(w, req, client, "bucket", "app.js", []string{"deflate"}))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+
+	req.Header.Set("Accept-Encoding", "br")
+	assert.Nil(t, s3getPrecompressed(httptest.NewRecorder(), req, client, "bucket", "app.css", encodings))
+}
+
+func TestS3getPrecompressedTypes(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{"photo.png.br": "brotli", "data.bin.br": "brotli"}}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/photo.png", nil)
+	req.Header.Set("Accept-Encoding", "br")
+
+	// Neither images nor unknown types are looked for
+	w := httptest.NewRecorder()
+	assert.Nil(t, s3getPrecompressed(w, req, client, "bucket", "photo.png", []string{"br"}))
+	assert.Nil(t, s3getPrecompressed(w, req, client, "bucket", "data.bin", []string{"br"}))
+	assert.Empty(t, client.ranges)
+	assert.Equal(t, "", w.Header().Get("Vary"))
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+)
+
+// Keys ending with this are symbolic links, e.g. /docs/latest/symlink.json/index.html
+const symlinkName = "symlink.json"
+
+// Links to links are followed up to this many times
+const maxSymlinkHops = 8
+
+// Targets of links are read again after this
+const symlinkTTL = time.Minute
+
+var (
+	errSymlinkLoop   = errors.New("too many levels of symbolic links")
+	errSymlinkBucket = errors.New("symbolic link to a bucket which is not in SYMLINK_BUCKETS")
+	errSymlinkURL    = errors.New("symbolic link without URL")
+)
+
+type symlink struct {
+	URL      string
+	loadedAt time.Time
+}
+
+var symlinkCache sync.Map // bucket + "/" + key -> symlink
+
+// resolveSymlinks replaces symlink.json in the path with the target of the
+// link, and so on for links the target leads to. Targets are
+//   - "s3://bucket/key" in another bucket listed in SYMLINK_BUCKETS
+//   - "/key" or "key" relative to AWS_S3_KEY_PREFIX
+//   - "./key" or "../key" relative to the directory of the link
+//
+// It returns the bucket and the key prefix which the resolved path is in.
+func resolveSymlinks(client service.AWS, bucket, keyPrefix, urlPath string) (string, string, string, error) {
+	visited := map[string]bool{}
+	for {
+		idx := strings.Index(urlPath, symlinkName)
+		if idx < 0 {
+			return bucket, keyPrefix, urlPath, nil
+		}
+		linkPath, rest := urlPath[:idx+len(symlinkName)], urlPath[idx+len(symlinkName):]
+		key := keyPrefix + linkPath
+		if visited[bucket+"/"+key] || len(visited) >= maxSymlinkHops {
+			return "", "", "", errSymlinkLoop
+		}
+		visited[bucket+"/"+key] = true
+
+		target, err := readSymlink(client, bucket, key)
+		if err != nil {
+			return "", "", "", err
+		}
+		switch {
+		case strings.HasPrefix(target, "s3://"):
+			u, err := url.Parse(target)
+			if err != nil {
+				return "", "", "", err
+			}
+			if !symlinkBucketAllowed(u.Host) {
+				return "", "", "", errSymlinkBucket
+			}
+			bucket, keyPrefix, target = u.Host, "", u.Path
+		case relativeSymlinkTarget(target):
+			target = path.Dir(linkPath) + "/" + target
+		}
+		target = cleanSymlinkTarget(target)
+		if strings.HasPrefix(rest, "/") {
+			target = strings.TrimSuffix(target, "/")
+		}
+		urlPath = target + rest
+	}
+}
+
+// relativeSymlinkTarget reports whether the target is relative to the link.
+// Others without a leading slash are relative to AWS_S3_KEY_PREFIX, as ever.
+func relativeSymlinkTarget(target string) bool {
+	return target == "." || target == ".." ||
+		strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../")
+}
+
+// cleanSymlinkTarget resolves ".." so that no target is above the root,
+// keeping the trailing slash of directories
+func cleanSymlinkTarget(target string) string {
+	cleaned := path.Clean("/" + target)
+	if strings.HasSuffix(target, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func symlinkBucketAllowed(bucket string) bool {
+	for _, allowed := range strings.Split(config.Config.SymlinkBuckets, ",") {
+		if allowed = strings.TrimSpace(allowed); len(allowed) > 0 && allowed == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// readSymlink returns the URL in the link, reading it from S3 at most once per symlinkTTL
+func readSymlink(client service.AWS, bucket, key string) (string, error) {
+	if cached, ok := symlinkCache.Load(bucket + "/" + key); ok {
+		if link := cached.(symlink); time.Since(link.loadedAt) < symlinkTTL {
+			return link.URL, nil
+		}
+	}
+	obj, err := client.S3get(bucket, key, nil)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Body.Close()
+
+	link := symlink{}
+	if err = json.NewDecoder(obj.Body).Decode(&link); err != nil {
+		return "", err
+	}
+	if len(link.URL) == 0 {
+		return "", errSymlinkURL
+	}
+	link.loadedAt = time.Now()
+	symlinkCache.Store(bucket+"/"+key, link)
+	return link.URL, nil
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSymlinks(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{
+		"prefix/abs/symlink.json":         `{"URL": "/docs/v2/"}`,
+		"prefix/bare/symlink.json":        `{"URL": "docs/v2/"}`,
+		"prefix/dot/symlink.json":         `{"URL": "./v2/"}`,
+		"prefix/docs/latest/symlink.json": `{"URL": "../v2/"}`,
+		"prefix/escape/symlink.json":      `{"URL": "../../../secret"}`,
+		"prefix/chain/symlink.json":       `{"URL": "/docs/latest/symlink.json"}`,
+		"prefix/file/symlink.json":        `{"URL": "../docs/v2/index.html"}`,
+		"prefix/other/symlink.json":       `{"URL": "s3://other-bucket/shared/"}`,
+		"prefix/forbidden/symlink.json":   `{"URL": "s3://secret-bucket/"}`,
+		"prefix/loop-a/symlink.json":      `{"URL": "/loop-b/symlink.json"}`,
+		"prefix/loop-b/symlink.json":      `{"URL": "/loop-a/symlink.json"}`,
+		"prefix/empty/symlink.json":       `{}`,
+		"prefix/hops/0/symlink.json":      `{"URL": "../1/symlink.json"}`,
+		"prefix/hops/1/symlink.json":      `{"URL": "../2/symlink.json"}`,
+		"prefix/hops/2/symlink.json":      `{"URL": "../3/symlink.json"}`,
+		"prefix/hops/3/symlink.json":      `{"URL": "../4/symlink.json"}`,
+		"prefix/hops/4/symlink.json":      `{"URL": "../5/symlink.json"}`,
+		"prefix/hops/5/symlink.json":      `{"URL": "../6/symlink.json"}`,
+		"prefix/hops/6/symlink.json":      `{"URL": "../7/symlink.json"}`,
+		"prefix/hops/7/symlink.json":      `{"URL": "../8/symlink.json"}`,
+		"prefix/hops/8/symlink.json":      `{"URL": "/"}`,
+		"prefix/not-json/symlink.json":    `URL`,
+	}}
+	config.Config.SymlinkBuckets = "other-bucket"
+	defer func() { config.Config.SymlinkBuckets = "" }()
+
+	for _, c := range []struct {
+		path, bucket, keyPrefix, expected string
+	}{
+		{"/no/link.html", "bucket", "prefix", "/no/link.html"},
+		{"/abs/symlink.json/index.html", "bucket", "prefix", "/docs/v2/index.html"},
+		{"/abs/symlink.json", "bucket", "prefix", "/docs/v2/"},
+		{"/docs/latest/symlink.json/", "bucket", "prefix", "/docs/v2/"},
+		{"/bare/symlink.json/index.html", "bucket", "prefix", "/docs/v2/index.html"},
+		{"/dot/symlink.json/index.html", "bucket", "prefix", "/dot/v2/index.html"},
+		{"/escape/symlink.json", "bucket", "prefix", "/secret"},
+		{"/chain/symlink.json/a/b.txt", "bucket", "prefix", "/docs/v2/a/b.txt"},
+		{"/file/symlink.json", "bucket", "prefix", "/docs/v2/index.html"},
+		{"/other/symlink.json/a.txt", "other-bucket", "", "/shared/a.txt"},
+	} {
+		bucket, keyPrefix, actual, err := resolveSymlinks(client, "bucket", "prefix", c.path)
+		assert.Nil(t, err, c.path)
+		assert.Equal(t, c.bucket, bucket, c.path)
+		assert.Equal(t, c.keyPrefix, keyPrefix, c.path)
+		assert.Equal(t, c.expected, actual, c.path)
+	}
+
+	for _, c := range []struct {
+		path string
+		code int
+	}{
+		{"/forbidden/symlink.json", http.StatusForbidden},
+		{"/loop-a/symlink.json/index.html", http.StatusLoopDetected},
+		{"/hops/0/symlink.json", http.StatusLoopDetected},
+		{"/missing/symlink.json", http.StatusNotFound},
+		{"/empty/symlink.json", http.StatusInternalServerError},
+		{"/not-json/symlink.json", http.StatusInternalServerError},
+	} {
+		_, _, _, err := resolveSymlinks(client, "bucket", "prefix", c.path)
+		code, _ := toHTTPError(err)
+		assert.Equal(t, c.code, code, c.path)
+	}
+}
+
+func TestSymlinkCache(t *testing.T) {
+	client := &fakeS3{objects: map[string]string{
+		"/cached/symlink.json": `{"URL": "/v1/"}`,
+	}}
+	_, _, actual, _ := resolveSymlinks(client, "bucket", "", "/cached/symlink.json/a.txt")
+	assert.Equal(t, "/v1/a.txt", actual)
+
+	client.objects["/cached/symlink.json"] = `{"URL": "/v2/"}`
+	_, _, actual, _ = resolveSymlinks(client, "bucket", "", "/cached/symlink.json/a.txt")
+	assert.Equal(t, "/v1/a.txt", actual)
+	assert.Len(t, client.ranges, 1)
+}
@@ -1,13 +1,10 @@
 package controllers
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"reflect"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/go-openapi/swag"
 	"github.com/pottava/aws-s3-proxy/internal/config"
+	common "github.com/pottava/aws-s3-proxy/internal/http"
 	"github.com/pottava/aws-s3-proxy/internal/service"
 )
 
@@ -36,6 +34,11 @@ func AwsS3(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	// Hidden keys do not exist as far as clients are concerned
+	if hiddenKey(c.S3KeyPrefix + path) {
+		http.NotFound(w, r)
+		return
+	}
 	// Range header
 	var rangeHeader *string
 	if candidate := r.Header.Get("Range"); !swag.IsZero(candidate) {
@@ -44,56 +47,76 @@ func AwsS3(w http.ResponseWriter, r *http.Request) {
 
 	client := service.NewClient(r.Context(), aws.String(config.Config.AwsRegion))
 
-	// Replace path with symlink.json
-	idx := strings.Index(path, "symlink.json")
-	if idx > -1 {
-		replaced, err := replacePathWithSymlink(client, c.S3Bucket, c.S3KeyPrefix+path[:idx+12])
-		if err != nil {
-			code, message := toHTTPError(err)
-			http.Error(w, message, code)
+	// Resolve symlink.json, which may lead to another bucket
+	bucket, keyPrefix, path, err := resolveSymlinks(client, c.S3Bucket, c.S3KeyPrefix, path)
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
+	}
+	if hiddenKey(keyPrefix+path) || acmeCacheKey(bucket, keyPrefix+path) {
+		http.NotFound(w, r)
+		return
+	}
+	// Members of zip and tar archives
+	if c.ArchiveBrowsing {
+		if idx := strings.Index(path, archiveSeparator); idx > -1 {
+			s3archive(w, r, client, bucket, keyPrefix+path[:idx], path[idx+len(archiveSeparator):])
 			return
 		}
-		path = aws.StringValue(replaced) + path[idx+12:]
 	}
 	// Ends with / -> listing or index.html
 	if strings.HasSuffix(path, "/") {
 		if c.DirectoryListing {
-			s3listFiles(w, r, client, c.S3Bucket, c.S3KeyPrefix+path)
+			s3listFiles(w, r, client, bucket, keyPrefix+path)
 			return
 		}
 		path += c.IndexDocument
 	}
+	// Multiple ranges -> multipart/byteranges
+	if rangeHeader != nil {
+		ranges := splitRanges(*rangeHeader)
+		if len(ranges) > maxRanges {
+			rangeHeader = nil
+		} else if len(ranges) > 1 {
+			s3multiRange(w, client, bucket, keyPrefix+path, ranges, c.HTTPCacheControl, c.HTTPExpires)
+			return
+		}
+	}
+	// Get a precompressed variant, if any
+	var obj *s3.GetObjectOutput
+	if rangeHeader == nil && len(c.PrecompressedEncodings) > 0 {
+		obj = s3getPrecompressed(w, r, client, bucket, keyPrefix+path,
+			common.SplitList(c.PrecompressedEncodings))
+	}
 	// Get a S3 object
-	obj, err := client.S3get(c.S3Bucket, c.S3KeyPrefix+path, rangeHeader)
-	if err != nil {
-		code, message := toHTTPError(err)
-		http.Error(w, message, code)
-		return
+	if obj == nil {
+		obj, err = client.S3get(bucket, keyPrefix+path, rangeHeader)
+		if err != nil {
+			code, message := toHTTPError(err)
+			http.Error(w, message, code)
+			return
+		}
 	}
 	setHeadersFromAwsResponse(w, obj, c.HTTPCacheControl, c.HTTPExpires)
 
 	io.Copy(w, obj.Body) // nolint
 }
 
-func replacePathWithSymlink(client service.AWS, bucket, symlinkPath string) (*string, error) {
-	obj, err := client.S3get(bucket, symlinkPath, nil)
-	if err != nil {
-		return nil, err
-	}
-	link := struct {
-		URL string
-	}{}
-	buf := new(bytes.Buffer)
-	if _, err = buf.ReadFrom(obj.Body); err != nil {
-		return nil, err
-	}
-	if err = json.Unmarshal(buf.Bytes(), &link); err != nil {
-		return nil, err
-	}
-	return aws.String(link.URL), nil
+func setHeadersFromAwsResponse(w http.ResponseWriter, obj *s3.GetObjectOutput, httpCacheControl, httpExpires string) {
+	setObjectHeaders(w, obj, httpCacheControl, httpExpires)
+	setStrHeader(w, "Content-Range", obj.ContentRange)
+	setStrHeader(w, "Content-Type", obj.ContentType)
+
+	// The body is passed through as stored, encoded or not. The compression
+	// layer fixes Content-Length up when it transforms the body.
+	setIntHeader(w, "Content-Length", obj.ContentLength)
+
+	w.WriteHeader(determineHTTPStatus(obj))
 }
 
-func setHeadersFromAwsResponse(w http.ResponseWriter, obj *s3.GetObjectOutput, httpCacheControl, httpExpires string) {
+// setObjectHeaders sets headers which do not depend on the part of the object in the body
+func setObjectHeaders(w http.ResponseWriter, obj *s3.GetObjectOutput, httpCacheControl, httpExpires string) {
 
 	// Cache-Control
 	if len(httpCacheControl) > 0 {
@@ -110,17 +133,9 @@ func setHeadersFromAwsResponse(w http.ResponseWriter, obj *s3.GetObjectOutput, h
 	setStrHeader(w, "Content-Disposition", obj.ContentDisposition)
 	setStrHeader(w, "Content-Encoding", obj.ContentEncoding)
 	setStrHeader(w, "Content-Language", obj.ContentLanguage)
-
-	// Fix https://github.com/pottava/aws-s3-proxy/issues/20
-	if len(w.Header().Get("Content-Encoding")) == 0 {
-		setIntHeader(w, "Content-Length", obj.ContentLength)
-	}
-	setStrHeader(w, "Content-Range", obj.ContentRange)
-	setStrHeader(w, "Content-Type", obj.ContentType)
+	setStrHeader(w, "Accept-Ranges", obj.AcceptRanges)
 	setStrHeader(w, "ETag", obj.ETag)
 	setTimeHeader(w, "Last-Modified", obj.LastModified)
-
-	w.WriteHeader(determineHTTPStatus(obj))
 }
 
 func setStrHeader(w http.ResponseWriter, key string, value *string) {
@@ -144,69 +159,92 @@ func setTimeHeader(w http.ResponseWriter, key string, value *time.Time) {
 func s3listFiles(w http.ResponseWriter, r *http.Request, client service.AWS, bucket, prefix string) {
 	prefix = strings.TrimPrefix(prefix, "/")
 
-	result, err := client.S3listObjects(bucket, prefix)
-	if err != nil {
-		code, message := toHTTPError(err)
-		http.Error(w, message, code)
+	if download := r.URL.Query().Get("download"); len(download) > 0 {
+		s3download(w, client, bucket, prefix, download)
 		return
 	}
-	files, updatedAt := convertToMaps(result, prefix)
-
-	// Output as a HTML
-	if strings.EqualFold(config.Config.DirListingFormat, "html") {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprintln(w, toHTML(files, updatedAt))
+	if recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive")); recursive {
+		s3listRecursive(w, r, client, bucket, prefix)
 		return
 	}
-	// Output as a JSON
-	bytes, merr := json.Marshal(files)
-	if merr != nil {
-		http.Error(w, merr.Error(), http.StatusInternalServerError)
+	limit, continuation, err := listingPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	fmt.Fprintln(w, string(bytes))
-}
-
-func convertToMaps(s3output *s3.ListObjectsOutput, prefix string) ([]string, map[string]time.Time) {
-	candidates := map[string]bool{}
-	updatedAt := map[string]time.Time{}
-
-	// Prefixes
-	for _, obj := range s3output.CommonPrefixes {
-		candidate := strings.TrimPrefix(aws.StringValue(obj.Prefix), prefix)
-		if len(candidate) == 0 {
-			continue
-		}
-		candidates[candidate] = true
+	if format, err := listingFormat(r); err == nil && (format == formatAtom || format == formatRSS) {
+		s3listFeed(w, r, client, bucket, prefix, continuation)
+		return
 	}
-	// Contents
-	for _, obj := range s3output.Contents {
-		candidate := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
-		if len(candidate) == 0 {
-			continue
-		}
-		candidates[candidate] = true
-		updatedAt[candidate] = *obj.LastModified
+	if listingFiltered(r) {
+		s3listFiltered(w, r, client, bucket, prefix, limit, continuation)
+		return
 	}
-	// Sort file names
-	files := []string{}
-	for file := range candidates {
-		files = append(files, file)
+	result, err := client.S3listObjects(bucket, prefix, limit, continuation)
+	if err != nil {
+		code, message := toHTTPError(err)
+		http.Error(w, message, code)
+		return
 	}
-	sort.Sort(s3objects(files))
+	writeListing(w, r, client, result, prefix)
+}
 
-	return files, updatedAt
+// writeListing writes the page of the listing in the format the client asks for
+func writeListing(w http.ResponseWriter, r *http.Request, client service.AWS, result *s3.ListObjectsV2Output, prefix string) {
+	entries, err := filterEntries(r, toEntries(result, prefix))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeEntries(w, r, client, result, prefix, entries)
 }
 
-func toHTML(files []string, updatedAt map[string]time.Time) string {
-	html := "<!DOCTYPE html><html><body><ul>"
-	for _, file := range files {
-		html += "<li><a href=\"" + file + "\">" + file + "</a>"
-		if timestamp, ok := updatedAt[file]; ok {
-			html += " " + timestamp.Format(time.RFC3339)
+// writeEntries writes the entries of the listing in the format the client asks for
+func writeEntries(w http.ResponseWriter, r *http.Request, client service.AWS, result *s3.ListObjectsV2Output, prefix string, entries []listingEntry) {
+	next := nextPageURL(r, result.NextContinuationToken)
+	if len(next) > 0 {
+		w.Header().Set("Link", "<"+next+">; rel=\"next\"")
+		w.Header().Set("X-Next-Continuation-Token", aws.StringValue(result.NextContinuationToken))
+	}
+	format, err := listingFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+
+	var body []byte
+	var contentType string
+	switch format {
+	case formatHTML:
+		body, err = toHTML(client, r.URL.Path, entries, next)
+		contentType = "text/html; charset=utf-8"
+	case formatXML:
+		body, err = toXML(r, result, prefix, entries)
+		contentType = "application/xml"
+	case formatText:
+		body = toText(entries)
+		contentType = "text/plain; charset=utf-8"
+	case formatAtom:
+		body, err = toAtom(r, entries)
+		contentType = "application/atom+xml"
+	case formatRSS:
+		body, err = toRSS(r, entries)
+		contentType = "application/rss+xml"
+	default:
+		var listing interface{} = entryNames(entries)
+		if config.Config.DirListingJSONVersion >= listingVersion {
+			listing = toListing(result, prefix, entries, next)
 		}
-		html += "</li>"
+		if body, err = json.Marshal(listing); err == nil {
+			body = append(body, '\n')
+		}
+		contentType = "application/json; charset=utf-8"
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	return html + "</ul></body></html>"
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body) // nolint
 }
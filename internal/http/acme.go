@@ -0,0 +1,76 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/pottava/aws-s3-proxy/internal/service"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	acmeOnce    sync.Once
+	acmeManager *autocert.Manager
+)
+
+// ACMEEnabled reports whether certificates are provisioned via ACME
+func ACMEEnabled() bool {
+	return len(config.Config.AcmeHosts) > 0
+}
+
+func getACMEManager() *autocert.Manager {
+	acmeOnce.Do(func() {
+		c := config.Config
+
+		var cache autocert.Cache
+		switch {
+		case len(c.AcmeCacheS3Prefix) > 0:
+			cache = service.S3CertCache{
+				Bucket: c.AcmeCacheS3Bucket,
+				Prefix: c.AcmeCacheS3Prefix,
+				Region: aws.String(c.AwsRegion),
+			}
+		case len(c.AcmeCacheDir) > 0:
+			cache = autocert.DirCache(c.AcmeCacheDir)
+		}
+		client := &acme.Client{DirectoryURL: c.AcmeDirectoryURL}
+		if c.InsecureTLS {
+			client.HTTPClient = &http.Client{Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint:gosec
+			}}
+		}
+		acmeManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(SplitList(c.AcmeHosts)...),
+			Cache:      cache,
+			Email:      c.AcmeEmail,
+			Client:     client,
+		}
+	})
+	return acmeManager
+}
+
+// ACMEHTTPHandler answers ACME HTTP-01 challenges and passes
+// other requests to the fallback handler
+func ACMEHTTPHandler(fallback http.Handler) http.Handler {
+	if !ACMEEnabled() {
+		return fallback
+	}
+	return getACMEManager().HTTPHandler(fallback)
+}
+
+// acmeHost reports whether the certificate for the host is provisioned via ACME
+func acmeHost(host string) bool {
+	for _, candidate := range SplitList(config.Config.AcmeHosts) {
+		if strings.EqualFold(candidate, host) {
+			return true
+		}
+	}
+	return false
+}
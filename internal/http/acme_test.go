@@ -0,0 +1,48 @@
+package http
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme"
+)
+
+func TestACMEHTTPHandlerDisabled(t *testing.T) {
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	ACMEHTTPHandler(fallback).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/x", nil))
+
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestTLSConfigWithACME(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "acme")
+	defer os.RemoveAll(dir)
+
+	c := config.Config
+	c.AcmeHosts = "a.example.com, b.example.com"
+	c.AcmeCacheDir = dir
+	defer func() {
+		c.AcmeHosts = ""
+		c.AcmeCacheDir = ""
+	}()
+	assert.True(t, TLSEnabled())
+	assert.True(t, acmeHost("B.example.com"))
+	assert.False(t, acmeHost("c.example.com"))
+
+	cfg, err := TLSConfig()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg.NextProtos, acme.ALPNProto)
+
+	// Hosts that are not configured are rejected without contacting the CA
+	_, err = cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.example.com"})
+	assert.NotNil(t, err)
+}
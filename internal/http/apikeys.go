@@ -0,0 +1,131 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// API key permissions
+const (
+	permRead  = "read"
+	permWrite = "write"
+	permList  = "list"
+)
+
+// apiKey is an entry of the API keys file, which is a JSON array such as
+// [{"name": "ci", "key": "...", "methods": ["read"], "prefixes": ["/builds/"], "expires": "2030-01-01T00:00:00Z"}]
+type apiKey struct {
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	KeySHA256 string     `json:"key_sha256"`
+	Methods   []string   `json:"methods"`
+	Prefixes  []string   `json:"prefixes"`
+	Expires   *time.Time `json:"expires"`
+	digest    []byte
+}
+
+type apiKeys []apiKey
+
+func parseAPIKeys(data []byte) (interface{}, error) {
+	keys := apiKeys{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		key := &keys[i]
+		if len(key.Name) == 0 {
+			return nil, fmt.Errorf("key #%d: name is required", i+1)
+		}
+		switch {
+		case len(key.KeySHA256) > 0:
+			digest, err := hex.DecodeString(key.KeySHA256)
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("%s: invalid key_sha256", key.Name)
+			}
+			key.digest = digest
+		case len(key.Key) > 0:
+			digest := sha256.Sum256([]byte(key.Key))
+			key.digest = digest[:]
+		default:
+			return nil, fmt.Errorf("%s: key or key_sha256 is required", key.Name)
+		}
+		if len(key.Methods) == 0 {
+			key.Methods = []string{permRead, permList}
+		}
+		for _, method := range key.Methods {
+			if method != permRead && method != permWrite && method != permList {
+				return nil, fmt.Errorf("%s: unknown method %q", key.Name, method)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// lookup compares the key against every entry in constant time
+func (keys apiKeys) lookup(key string) *apiKey {
+	digest := sha256.Sum256([]byte(key))
+	var found *apiKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare(keys[i].digest, digest[:]) == 1 {
+			found = &keys[i]
+		}
+	}
+	return found
+}
+
+func (k *apiKey) expired() bool {
+	return k.Expires != nil && time.Now().After(*k.Expires)
+}
+
+func (k *apiKey) permits(r *http.Request) bool {
+	required := permRead
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if strings.HasSuffix(r.URL.Path, "/") && config.Config.DirectoryListing {
+			required = permList
+		}
+	default:
+		required = permWrite
+	}
+	for _, method := range k.Methods {
+		if method == required {
+			return allowedPath(k.Prefixes, r.URL.Path)
+		}
+	}
+	return false
+}
+
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if key, found := header(r, "X-Api-Key"); found {
+		return key, true
+	}
+	if authorization, found := header(r, "Authorization"); found &&
+		len(authorization) > 7 && strings.EqualFold(authorization[:7], "ApiKey ") {
+		return strings.TrimSpace(authorization[7:]), true
+	}
+	return "", false
+}
+
+// authAPIKey returns the name of the key, or writes an error response
+func authAPIKey(w http.ResponseWriter, r *http.Request, path, key string) (string, bool) {
+	keys, _ := watch(path, parseAPIKeys).(apiKeys)
+	found := keys.lookup(key)
+	if found == nil || found.expired() {
+		w.Header().Set("WWW-Authenticate", "ApiKey")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return "", false
+	}
+	if !found.permits(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return "", false
+	}
+	return found.Name, true
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleAPIKeys = `[
+  {"name": "ci", "key": "secret", "methods": ["read"], "prefixes": ["/builds/"]},
+  {"name": "lister", "key_sha256": "35224d0d3465d74e855f8d69a136e79c744ea35a675d3393360a327cbf6359a2", "methods": ["list"]},
+  {"name": "expired", "key": "old", "expires": "2000-01-01T00:00:00Z"}
+]`
+
+func TestParseAPIKeys(t *testing.T) {
+	parsed, err := parseAPIKeys([]byte(sampleAPIKeys))
+
+	assert.Nil(t, err)
+	keys := parsed.(apiKeys)
+	assert.Equal(t, 3, len(keys))
+	assert.Equal(t, []string{permRead, permList}, keys[2].Methods)
+}
+
+func TestParseInvalidAPIKeys(t *testing.T) {
+	_, err := parseAPIKeys([]byte(`[{"name": "ci"}]`))
+	assert.NotNil(t, err)
+
+	_, err = parseAPIKeys([]byte(`[{"name": "ci", "key": "k", "methods": ["delete"]}]`))
+	assert.NotNil(t, err)
+}
+
+func TestLookupAPIKey(t *testing.T) {
+	parsed, _ := parseAPIKeys([]byte(sampleAPIKeys))
+	keys := parsed.(apiKeys)
+
+	assert.Equal(t, "ci", keys.lookup("secret").Name)
+	assert.Equal(t, "lister", keys.lookup("secret2").Name)
+	assert.True(t, keys.lookup("old").expired())
+	assert.Nil(t, keys.lookup("unknown"))
+}
+
+func TestAPIKeyFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("X-Api-Key", "secret")
+	key, found := apiKeyFromRequest(req)
+	assert.True(t, found)
+	assert.Equal(t, "secret", key)
+
+	req = httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Authorization", "ApiKey secret")
+	key, found = apiKeyFromRequest(req)
+	assert.True(t, found)
+	assert.Equal(t, "secret", key)
+
+	req = httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	_, found = apiKeyFromRequest(req)
+	assert.False(t, found)
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "apikeys")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(path, []byte(sampleAPIKeys), 0600) // nolint
+
+	config.Config.DirectoryListing = true
+	defer func() { config.Config.DirectoryListing = false }()
+
+	cases := []struct {
+		method, url, key string
+		status           int
+	}{
+		{http.MethodGet, "http://example.com/builds/1.zip", "secret", http.StatusOK},
+		{http.MethodGet, "http://example.com/other/1.zip", "secret", http.StatusForbidden},
+		{http.MethodGet, "http://example.com/builds/", "secret", http.StatusForbidden},
+		{http.MethodPut, "http://example.com/builds/1.zip", "secret", http.StatusForbidden},
+		{http.MethodGet, "http://example.com/builds/", "secret2", http.StatusOK},
+		{http.MethodGet, "http://example.com/builds/1.zip", "old", http.StatusUnauthorized},
+		{http.MethodGet, "http://example.com/builds/1.zip", "wrong", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(c.method, c.url, nil)
+		_, ok := authAPIKey(w, req, path, c.key)
+		if c.status == http.StatusOK {
+			assert.True(t, ok, c.url)
+		} else {
+			assert.False(t, ok, c.url)
+			assert.Equal(t, c.status, w.Code, c.url)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// clientCertIdentity returns the identity of a verified client certificate,
+// which is empty when the certificate lacks the configured field
+func clientCertIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return certIdentity(r.TLS.VerifiedChains[0][0], config.Config.ClientCertIdentity), true
+}
+
+// certIdentity maps a certificate to an identity. The source is one of
+// "cn", "dns", "email" or "uri"; when empty, the first URI, DNS or email
+// subject alternative name is used, then the common name.
+func certIdentity(cert *x509.Certificate, source string) string {
+	uris := []string{}
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	switch strings.ToLower(source) {
+	case "cn":
+		return cert.Subject.CommonName
+	case "dns":
+		return first(cert.DNSNames)
+	case "email":
+		return first(cert.EmailAddresses)
+	case "uri":
+		return first(uris)
+	}
+	for _, candidates := range [][]string{uris, cert.DNSNames, cert.EmailAddresses} {
+		if len(candidates) > 0 {
+			return candidates[0]
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+func first(values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// clientCertAllowed applies CLIENT_CERT_PREFIXES to the identity.
+// Without the rules, every verified certificate can access every path.
+func clientCertAllowed(identity, path string) bool {
+	rules := config.Config.ClientCertPrefixes
+	if len(rules) == 0 {
+		return true
+	}
+	if len(identity) == 0 {
+		return false
+	}
+	prefixes, found := parsePrefixRules(rules)[identity]
+	if !found {
+		return false
+	}
+	return allowedPath(strings.Fields(prefixes), path)
+}
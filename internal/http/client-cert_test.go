@@ -0,0 +1,77 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/svc")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "svc-a"},
+		DNSNames:       []string{"svc-a.example.com"},
+		EmailAddresses: []string{"svc-a@example.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+	assert.Equal(t, "spiffe://example.com/svc", certIdentity(cert, ""))
+	assert.Equal(t, "svc-a", certIdentity(cert, "cn"))
+	assert.Equal(t, "svc-a.example.com", certIdentity(cert, "dns"))
+	assert.Equal(t, "svc-a@example.com", certIdentity(cert, "email"))
+	assert.Equal(t, "svc-a", certIdentity(&x509.Certificate{Subject: pkix.Name{CommonName: "svc-a"}}, ""))
+}
+
+func TestClientCertIdentity(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	_, found := clientCertIdentity(req)
+	assert.False(t, found)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "svc-a"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	identity, found := clientCertIdentity(req)
+	assert.True(t, found)
+	assert.Equal(t, "svc-a", identity)
+
+	// A verified certificate without the field still counts
+	config.Config.ClientCertIdentity = "email"
+	defer func() { config.Config.ClientCertIdentity = "" }()
+	identity, found = clientCertIdentity(req)
+	assert.True(t, found)
+	assert.Equal(t, "", identity)
+}
+
+func TestClientCertWithoutIdentity(t *testing.T) {
+	config.Config.ClientCertIdentity = "email"
+	config.Config.ClientCertPrefixes = "svc-a@example.com=/a/"
+	defer func() {
+		config.Config.ClientCertIdentity = ""
+		config.Config.ClientCertPrefixes = ""
+	}()
+	req := httptest.NewRequest(http.MethodGet, "/a/file", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "svc-a"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	w := httptest.NewRecorder()
+	_, ok := authenticate(w, req)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestClientCertAllowed(t *testing.T) {
+	assert.True(t, clientCertAllowed("svc-a", "/any"))
+
+	config.Config.ClientCertPrefixes = "svc-a=/a/ /shared/;svc-b=/b/"
+	defer func() { config.Config.ClientCertPrefixes = "" }()
+
+	assert.True(t, clientCertAllowed("svc-a", "/shared/file"))
+	assert.False(t, clientCertAllowed("svc-a", "/b/file"))
+	assert.False(t, clientCertAllowed("svc-c", "/a/file"))
+	assert.False(t, clientCertAllowed("", "/a/file"))
+}
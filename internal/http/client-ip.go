@@ -0,0 +1,177 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+var cidrCache sync.Map
+
+// unixPeers in TRUSTED_PROXIES or PROXY_PROTOCOL_TRUSTED_CIDRS trusts peers
+// connected via Unix domain sockets, which have no address
+const unixPeers = "unix"
+
+// parseCIDRs parses a comma or space separated list of CIDR ranges or IP addresses
+func parseCIDRs(list string) []*net.IPNet {
+	if cached, ok := cidrCache.Load(list); ok {
+		return cached.([]*net.IPNet)
+	}
+	nets := []*net.IPNet{}
+	for _, element := range SplitList(list) {
+		for _, candidate := range strings.Fields(element) {
+			if !strings.Contains(candidate, "/") {
+				if ip := net.ParseIP(candidate); ip != nil {
+					bits := 8 * net.IPv6len
+					if ip.To4() != nil {
+						ip = ip.To4()
+						bits = 8 * net.IPv4len
+					}
+					nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+					continue
+				}
+			}
+			if _, ipnet, err := net.ParseCIDR(candidate); err == nil {
+				nets = append(nets, ipnet)
+			}
+		}
+	}
+	cidrCache.Store(list, nets)
+	return nets
+}
+
+// trustsUnixPeers reports whether the list contains the "unix" token
+func trustsUnixPeers(list string) bool {
+	for _, element := range SplitList(list) {
+		for _, candidate := range strings.Fields(element) {
+			if strings.EqualFold(candidate, unixPeers) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unixPeer reports whether the request came in on a Unix domain socket
+func unixPeer(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. Only TRUSTED_PROXY_HEADER is
+// honored, as proxies append to one header and pass the others through, and
+// only while the hops it passes through are listed in TRUSTED_PROXIES.
+func clientIP(r *http.Request) net.IP {
+	remote := parseHostIP(r.RemoteAddr)
+	trusted := parseCIDRs(config.Config.TrustedProxies)
+	if !containsIP(trusted, remote) &&
+		!(remote == nil && unixPeer(r) && trustsUnixPeers(config.Config.TrustedProxies)) {
+		return remote
+	}
+	client := remote
+	hops := forwardedFor(r, config.Config.TrustedProxyHeader)
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHostIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the addresses in the header, ordered from the original
+// client to the nearest proxy
+func forwardedFor(r *http.Request, name string) []string {
+	hops := []string{}
+	switch http.CanonicalHeaderKey(name) {
+	case "Forwarded":
+		for _, element := range SplitList(strings.Join(r.Header["Forwarded"], ",")) {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					hops = append(hops, strings.Trim(pair[4:], `"`))
+				}
+			}
+		}
+	case "X-Real-Ip":
+		if realIP, found := header(r, "X-Real-Ip"); found {
+			hops = append(hops, realIP)
+		}
+	default:
+		for _, value := range r.Header["X-Forwarded-For"] {
+			hops = append(hops, SplitList(value)...)
+		}
+	}
+	return hops
+}
+
+// parseHostIP parses "ip", "ip:port", "[ipv6]" and "[ipv6]:port"
+func parseHostIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// ipAllowed applies the global and per-prefix allow and deny lists
+func ipAllowed(ip net.IP, path string) bool {
+	c := config.Config
+	if !aclAllows(ip, c.IPAllowList, c.IPDenyList) {
+		return false
+	}
+	for prefix, list := range parsePrefixRules(c.IPAllowByPrefix) {
+		if strings.HasPrefix(path, prefix) && !aclAllows(ip, list, "") {
+			return false
+		}
+	}
+	for prefix, list := range parsePrefixRules(c.IPDenyByPrefix) {
+		if strings.HasPrefix(path, prefix) && !aclAllows(ip, "", list) {
+			return false
+		}
+	}
+	return true
+}
+
+func aclAllows(ip net.IP, allow, deny string) bool {
+	if len(deny) > 0 && containsIP(parseCIDRs(deny), ip) {
+		return false
+	}
+	if len(allow) > 0 && !containsIP(parseCIDRs(allow), ip) {
+		return false
+	}
+	return true
+}
+
+// parsePrefixRules parses "/prefix/=10.0.0.0/8 192.168.0.0/16;/other/=..."
+func parsePrefixRules(rules string) map[string]string {
+	parsed := map[string]string{}
+	for _, rule := range strings.Split(rules, ";") {
+		if idx := strings.Index(rule, "="); idx > 0 {
+			parsed[strings.TrimSpace(rule[:idx])] = rule[idx+1:]
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets := parseCIDRs("10.0.0.0/8, 192.168.1.1 ::1 invalid")
+
+	assert.Equal(t, 3, len(nets))
+	assert.True(t, containsIP(nets, net.ParseIP("10.1.2.3")))
+	assert.True(t, containsIP(nets, net.ParseIP("192.168.1.1")))
+	assert.False(t, containsIP(nets, net.ParseIP("192.168.1.2")))
+	assert.True(t, containsIP(nets, net.ParseIP("::1")))
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	config.Config.TrustedProxies = ""
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	assert.Equal(t, "203.0.113.1", clientIP(req).String())
+}
+
+func TestClientIPWithXForwardedFor(t *testing.T) {
+	config.Config.TrustedProxies = "10.0.0.0/8"
+	defer func() { config.Config.TrustedProxies = "" }()
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 198.51.100.1, 10.0.0.2")
+
+	assert.Equal(t, "198.51.100.1", clientIP(req).String())
+}
+
+func TestClientIPWithForwarded(t *testing.T) {
+	config.Config.TrustedProxies = "10.0.0.0/8"
+	config.Config.TrustedProxyHeader = "Forwarded"
+	defer func() {
+		config.Config.TrustedProxies = ""
+		config.Config.TrustedProxyHeader = "X-Forwarded-For"
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	assert.Equal(t, "2001:db8::1", clientIP(req).String())
+}
+
+func TestClientIPWithXRealIP(t *testing.T) {
+	config.Config.TrustedProxies = "10.0.0.1"
+	config.Config.TrustedProxyHeader = "X-Real-IP"
+	defer func() {
+		config.Config.TrustedProxies = ""
+		config.Config.TrustedProxyHeader = "X-Forwarded-For"
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "198.51.100.1")
+
+	assert.Equal(t, "198.51.100.1", clientIP(req).String())
+}
+
+func TestClientIPIgnoresOtherHeaders(t *testing.T) {
+	config.Config.TrustedProxies = "10.0.0.0/8"
+	defer func() { config.Config.TrustedProxies = "" }()
+
+	// The proxy appends to X-Forwarded-For, and passes the others through
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Forwarded", "for=192.168.1.5")
+	req.Header.Set("X-Real-IP", "192.168.1.5")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	assert.Equal(t, "203.0.113.9", clientIP(req).String())
+
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", clientIP(req).String())
+}
+
+func TestClientIPOnUnixSocket(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey,
+		&net.UnixAddr{Name: "/run/proxy.sock", Net: "unix"}))
+	req.RemoteAddr = "@"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	config.Config.TrustedProxies = ""
+	assert.Nil(t, clientIP(req))
+
+	config.Config.TrustedProxies = "10.0.0.0/8, unix"
+	defer func() { config.Config.TrustedProxies = "" }()
+	assert.Equal(t, "198.51.100.1", clientIP(req).String())
+
+	// TCP peers without addresses are not trusted
+	req = httptest.NewRequest(http.MethodGet, sample, nil)
+	req.RemoteAddr = "@"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Nil(t, clientIP(req))
+}
+
+func TestIPAllowed(t *testing.T) {
+	c := config.Config
+	c.IPAllowList = "10.0.0.0/8"
+	c.IPDenyList = "10.0.0.13"
+	c.IPAllowByPrefix = "/admin/=10.1.0.0/16"
+	c.IPDenyByPrefix = "/public/=10.2.0.0/16;/other/=10.3.0.0/16"
+	defer func() {
+		c.IPAllowList = ""
+		c.IPDenyList = ""
+		c.IPAllowByPrefix = ""
+		c.IPDenyByPrefix = ""
+	}()
+	assert.True(t, ipAllowed(net.ParseIP("10.0.0.1"), "/foo"))
+	assert.False(t, ipAllowed(net.ParseIP("10.0.0.13"), "/foo"))
+	assert.False(t, ipAllowed(net.ParseIP("192.168.0.1"), "/foo"))
+	assert.True(t, ipAllowed(net.ParseIP("10.1.0.1"), "/admin/"))
+	assert.False(t, ipAllowed(net.ParseIP("10.0.0.1"), "/admin/"))
+	assert.False(t, ipAllowed(net.ParseIP("10.2.0.1"), "/public/"))
+	assert.True(t, ipAllowed(net.ParseIP("10.2.0.1"), "/foo"))
+}
@@ -0,0 +1,245 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// NegotiateEncoding returns the content-coding the client prefers among the
+// supported ones, which are listed in the server's order of preference.
+// It returns an empty string when none of them is acceptable.
+func NegotiateEncoding(r *http.Request, supported []string) string {
+	accepted, found := header(r, "Accept-Encoding")
+	if !found {
+		return ""
+	}
+	qvalues := parseAcceptEncoding(accepted)
+	best, bestQ := "", 0.0
+	for _, coding := range supported {
+		q, ok := qvalues[coding]
+		if !ok {
+			if q, ok = qvalues["*"]; !ok {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding parses "br;q=1.0, gzip;q=0.8, *;q=0.1" into q-values
+func parseAcceptEncoding(value string) map[string]float64 {
+	qvalues := map[string]float64{}
+	for _, element := range SplitList(value) {
+		params := strings.Split(element, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if len(coding) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qvalues[coding] = q
+	}
+	return qvalues
+}
+
+// Compressible reports whether the media type is in CONTENT_ENCODING_TYPES
+func Compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range SplitList(config.Config.ContentEncodingTypes) {
+		candidate = strings.ToLower(candidate)
+		if candidate == mediaType ||
+			(strings.HasSuffix(candidate, "/*") && strings.HasPrefix(mediaType, candidate[:len(candidate)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(h http.Header, name string) {
+	for _, value := range h["Vary"] {
+		for _, field := range SplitList(value) {
+			if strings.EqualFold(field, name) || field == "*" {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+func newEncoder(coding string, w io.Writer) io.WriteCloser {
+	switch coding {
+	case "br":
+		return brotli.NewWriter(w)
+	case "zstd":
+		if z, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1)); err == nil {
+			return z
+		}
+	case "gzip":
+		return gzip.NewWriter(w)
+	case "deflate":
+		return zlib.NewWriter(w)
+	}
+	return nil
+}
+
+// compressWriter compresses the response body when the client accepts it and
+// the response is worth compressing. Since that depends on the headers the
+// handler sets, the decision is deferred until the status line is written,
+// or until enough of a body of unknown length is buffered.
+type compressWriter struct {
+	http.ResponseWriter
+	coding  string
+	minSize int64
+	status  int
+	decided bool
+	buf     []byte
+	encoder io.WriteCloser
+}
+
+func newCompressWriter(w http.ResponseWriter, r *http.Request) *compressWriter {
+	return &compressWriter{
+		ResponseWriter: w,
+		coding:         NegotiateEncoding(r, SplitList(config.Config.ContentEncodingAlgorithms)),
+		minSize:        config.Config.ContentEncodingMinSize,
+	}
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	// Partial content is a range of the identity representation, and
+	// re-encoding a body already encoded would corrupt it
+	h := cw.Header()
+	if status != http.StatusOK || len(h.Get("Content-Range")) > 0 ||
+		len(h.Get("Content-Encoding")) > 0 || !Compressible(h.Get("Content-Type")) {
+		cw.decide(false)
+		return
+	}
+	addVary(h, "Accept-Encoding")
+	if len(cw.coding) == 0 {
+		cw.decide(false)
+		return
+	}
+	if length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		cw.decide(length >= cw.minSize)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if int64(len(cw.buf)) >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide writes the status line and the buffered body, compressed or not
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	if compress && len(cw.coding) > 0 {
+		cw.encoder = newEncoder(cw.coding, cw.ResponseWriter)
+	}
+	if cw.encoder != nil {
+		cw.setEncodedHeaders()
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// Flush sends what has been written so far. A body of unknown length is
+// compressed from here on, since it is being streamed.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true) // nolint
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush() // nolint
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setEncodedHeaders replaces the headers describing the identity representation
+func (cw *compressWriter) setEncodedHeaders() {
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.coding)
+	h.Del("Content-Length")
+
+	// Byte ranges would refer to the identity representation
+	h.Del("Accept-Ranges")
+
+	// The encoded representation is not byte-for-byte the same
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, "\"") {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+// Close flushes the buffered body and finishes the compressed stream.
+// A body still buffered at this point is complete and smaller than the
+// threshold, so it is sent as is with the exact Content-Length.
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+	if !cw.decided {
+		if len(cw.buf) > 0 {
+			cw.Header().Set("Content-Length", strconv.Itoa(len(cw.buf)))
+		}
+		return cw.decide(false)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
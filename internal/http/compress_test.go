@@ -0,0 +1,164 @@
+package http
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+var supportedEncodings = []string{"br", "zstd", "gzip", "deflate"}
+
+func negotiate(acceptEncoding string) string {
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	return NegotiateEncoding(req, supportedEncodings)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", NegotiateEncoding(httptest.NewRequest(http.MethodGet, sample, nil), supportedEncodings))
+	assert.Equal(t, "br", negotiate("gzip, deflate, br"))
+	assert.Equal(t, "gzip", negotiate("gzip;q=1.0, br;q=0.5"))
+	assert.Equal(t, "zstd", negotiate("br;q=0, *"))
+	assert.Equal(t, "deflate", negotiate("DEFLATE"))
+	assert.Equal(t, "", negotiate("identity"))
+	assert.Equal(t, "", negotiate("gzip;q=0"))
+	assert.Equal(t, "", negotiate("*;q=0"))
+}
+
+func serveCompressed(acceptEncoding, contentType, body string, withLength bool) *httptest.ResponseRecorder {
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if withLength {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		w.Write([]byte(body)) // nolint
+	})
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressByEncoding(t *testing.T) {
+	body := strings.Repeat("compressible text ", 200)
+
+	w := serveCompressed("br", "text/html; charset=utf-8", body, true)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Content-Length"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	actual, _ := ioutil.ReadAll(brotli.NewReader(w.Body))
+	assert.Equal(t, body, string(actual))
+
+	w = serveCompressed("zstd", "application/json", body, false)
+	assert.Equal(t, "zstd", w.Header().Get("Content-Encoding"))
+	z, _ := zstd.NewReader(w.Body)
+	actual, _ = ioutil.ReadAll(z)
+	assert.Equal(t, body, string(actual))
+
+	w = serveCompressed("gzip", "image/svg+xml", body, true)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	g, _ := gzip.NewReader(w.Body)
+	actual, _ = ioutil.ReadAll(g)
+	assert.Equal(t, body, string(actual))
+}
+
+func TestCompressSkipped(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+
+	// Not in the allowlist
+	w := serveCompressed("gzip", "image/png", body, true)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+	assert.Equal(t, "2048", w.Header().Get("Content-Length"))
+	assert.Equal(t, body, w.Body.String())
+
+	// Smaller than the threshold, with and without Content-Length
+	w = serveCompressed("gzip", "text/plain", "small", true)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, "small", w.Body.String())
+
+	w = serveCompressed("gzip", "text/plain", "small", false)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "small", w.Body.String())
+
+	// Not acceptable
+	w = serveCompressed("identity", "text/plain", body, true)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestCompressIdentityHeaders(t *testing.T) {
+	body := strings.Repeat("compressible text ", 200)
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(body)) // nolint
+	})
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Content-Length"))
+	assert.Equal(t, "", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, `W/"abc"`, w.Header().Get("ETag"))
+}
+
+func TestCompressBufferedBodyLength(t *testing.T) {
+	w := serveCompressed("gzip", "text/plain", "small", false)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "5", w.Header().Get("Content-Length"))
+}
+
+func TestCompressSkipsPartialContent(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Content-Range", "bytes 0-2047/4096")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(body)) // nolint
+	})
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-2047")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "2048", w.Header().Get("Content-Length"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{}\n")) // nolint
+		w.(http.Flusher).Flush()
+	})
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	g, _ := gzip.NewReader(w.Body)
+	actual, _ := ioutil.ReadAll(g)
+	assert.Equal(t, "{}\n", string(actual))
+}
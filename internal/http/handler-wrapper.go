@@ -1,9 +1,7 @@
 package http
 
 import (
-	"compress/gzip"
-	"compress/zlib"
-	"io"
+	"crypto/subtle"
 	"log"
 	"net/http"
 	"strconv"
@@ -35,60 +33,128 @@ func WrapHandler(handler func(w http.ResponseWriter, r *http.Request)) http.Hand
 			w.Header().Set("Access-Control-Allow-Headers", c.CorsAllowHeaders)
 			w.Header().Set("Access-Control-Max-Age", strconv.FormatInt(c.CorsMaxAge, 10))
 		}
-		// BasicAuth
-		if (len(c.BasicAuthUser) > 0) && (len(c.BasicAuthPass) > 0) &&
-			!auth(r, c.BasicAuthUser, c.BasicAuthPass) {
-			w.Header().Set("WWW-Authenticate", `Basic realm="REALM"`)
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		// HSTS
+		if hsts := hstsHeader(); r.TLS != nil && len(hsts) > 0 {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+		// IP address based access control
+		ip := clientIP(r)
+		if !ipAllowed(ip, r.URL.Path) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 			return
 		}
-		// Auth with JWT
-		if len(c.JwtSecretKey) > 0 && !isValidJwt(r) {
-			w.Header().Set("WWW-Authenticate", `Basic realm="REALM"`)
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		// Authentication
+		identity, ok := authenticate(w, r)
+		if !ok {
 			return
 		}
 		proc := time.Now()
 		addr := r.RemoteAddr
-		if ip, found := header(r, "X-Forwarded-For"); found {
-			addr = ip
+		if ip != nil {
+			addr = ip.String()
+		} else if unixPeer(r) {
+			addr = unixPeers
 		}
 		// Content-Encoding
-		ioWriter := w.(io.Writer)
-		if encodings, found := header(r, "Accept-Encoding"); found && c.ContentEncoding {
-			for _, encoding := range splitCsvLine(encodings) {
-				if encoding == "gzip" {
-					w.Header().Set("Content-Encoding", "gzip")
-					g := gzip.NewWriter(w)
-					defer g.Close()
-					ioWriter = g
-					break
-				}
-				if encoding == "deflate" {
-					w.Header().Set("Content-Encoding", "deflate")
-					z := zlib.NewWriter(w)
-					defer z.Close()
-					ioWriter = z
-					break
-				}
-			}
+		var rw http.ResponseWriter = w
+		if c.ContentEncoding {
+			cw := newCompressWriter(w, r)
+			defer cw.Close()
+			rw = cw
 		}
 		// Handle HTTP requests
-		writer := &custom{Writer: ioWriter, ResponseWriter: w, status: http.StatusOK}
+		writer := &custom{Writer: rw, ResponseWriter: rw, status: http.StatusOK}
 		handler(writer, r)
 
 		// AccessLog
 		if c.AccessLog {
-			log.Printf("[%s] %.3f %d %s %s",
+			if len(identity) == 0 {
+				identity = "-"
+			}
+			log.Printf("[%s] %.3f %d %s %s %s",
 				addr, time.Since(proc).Seconds(),
-				writer.status, r.Method, r.URL)
+				writer.status, r.Method, r.URL, identity)
 		}
 	})
 }
 
+// authenticate verifies the request with the configured methods and returns
+// the authenticated identity. It returns false when it has written an error.
+func authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	c := config.Config
+
+	// API keys take precedence over the other methods when presented
+	if len(c.APIKeysFile) > 0 {
+		if key, found := apiKeyFromRequest(r); found {
+			return authAPIKey(w, r, c.APIKeysFile, key)
+		}
+	}
+	// Verified client certificates
+	if identity, found := clientCertIdentity(r); found {
+		if !clientCertAllowed(identity, r.URL.Path) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return "", false
+		}
+		return identity, true
+	}
+	identity := ""
+	others := false
+
+	// BasicAuth
+	if len(c.BasicAuthHtpasswd) > 0 {
+		others = true
+		username, ok, allowed := authHtpasswd(r, c.BasicAuthHtpasswd)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="REALM"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return "", false
+		}
+		if !allowed {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return "", false
+		}
+		identity = username
+	} else if (len(c.BasicAuthUser) > 0) && (len(c.BasicAuthPass) > 0) {
+		others = true
+		if !auth(r, c.BasicAuthUser, c.BasicAuthPass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="REALM"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return "", false
+		}
+		identity = c.BasicAuthUser
+	}
+	// Auth with JWT
+	if len(c.JwtSecretKey) > 0 {
+		others = true
+		if !isValidJwt(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="REALM"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return "", false
+		}
+	}
+	// OpenID Connect
+	if len(c.OidcIssuer) > 0 {
+		others = true
+		email, ok := authOIDC(w, r)
+		if !ok {
+			return "", false
+		}
+		identity = email
+	}
+	// API keys are the only method, but no key was presented
+	if len(c.APIKeysFile) > 0 && !others {
+		w.Header().Set("WWW-Authenticate", "ApiKey")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return "", false
+	}
+	return identity, true
+}
+
 func auth(r *http.Request, authUser, authPass string) bool {
 	if username, password, ok := r.BasicAuth(); ok {
-		return username == authUser && password == authPass
+		userOK := subtle.ConstantTimeCompare([]byte(username), []byte(authUser)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(password), []byte(authPass)) == 1
+		return userOK && passOK
 	}
 	return false
 }
@@ -103,11 +169,13 @@ func header(r *http.Request, key string) (string, bool) {
 	return "", false
 }
 
-func splitCsvLine(data string) []string {
-	splitted := strings.SplitN(data, ",", -1)
-	parsed := make([]string, len(splitted))
-	for i, val := range splitted {
-		parsed[i] = strings.TrimSpace(val)
+// SplitList splits a comma-delimited list, trimming spaces and dropping empty elements
+func SplitList(data string) []string {
+	parsed := []string{}
+	for _, val := range strings.Split(data, ",") {
+		if val = strings.TrimSpace(val); len(val) > 0 {
+			parsed = append(parsed, val)
+		}
 	}
 	return parsed
 }
@@ -97,7 +97,7 @@ func TestHeaderWithoutValue(t *testing.T) {
 func TestSplitCsvLine(t *testing.T) {
 	expected := 3
 
-	lines := splitCsvLine("1,2,3")
+	lines := SplitList("1,2,3")
 
 	assert.Equal(t, expected, len(lines))
 }
@@ -105,10 +105,14 @@ func TestSplitCsvLine(t *testing.T) {
 func TestTrimedSplitCsvLine(t *testing.T) {
 	expected := 3
 
-	lines := splitCsvLine("1 , 2 ,3 ")
+	lines := SplitList("1 , 2 ,3 ")
 
 	assert.Equal(t, expected, len(lines))
 	assert.Equal(t, "1", lines[0])
 	assert.Equal(t, "2", lines[1])
 	assert.Equal(t, "3", lines[2])
 }
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"br", "gzip", "zstd"}, SplitList("br, gzip,,zstd "))
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" // nolint:gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswd maps user names to their credentials.
+// Each line is "user:hash[:prefix,prefix...]", where hash is bcrypt ($2y$...),
+// SHA1 ({SHA}...) or a plain text password.
+type htpasswd map[string]htpasswdUser
+
+type htpasswdUser struct {
+	hash     string
+	prefixes []string
+}
+
+func parseHtpasswd(data []byte) (interface{}, error) {
+	users := htpasswd{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, ":", 3)
+		if len(fields) < 2 || len(fields[0]) == 0 || len(fields[1]) == 0 {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		user := htpasswdUser{hash: fields[1]}
+		if len(fields) == 3 {
+			for _, prefix := range SplitList(fields[2]) {
+				if len(prefix) > 0 {
+					user.prefixes = append(user.prefixes, prefix)
+				}
+			}
+		}
+		users[fields[0]] = user
+	}
+	return users, scanner.Err()
+}
+
+// unknownUserHash is checked against for unknown users, so that they take as
+// long as users with bcrypt hashes and cannot be told apart by the response time
+const unknownUserHash = "$2a$10$k1W0nqPBJ8gQSKvWMEqjjeWs3f0yf.qanIJRKZV1sgEmqAUR6VMHW"
+
+// authenticate returns the user if the password matches its hash
+func (h htpasswd) authenticate(username, password string) (htpasswdUser, bool) {
+	user, found := h[username]
+	if !found {
+		verifyPassword(unknownUserHash, password)
+		return htpasswdUser{}, false
+	}
+	return user, verifyPassword(user.hash, password)
+}
+
+func verifyPassword(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password)) // nolint:gosec
+		encoded := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(encoded)) == 1
+	case strings.HasPrefix(hash, "$"):
+		// Unsupported crypt(3) schemes such as $apr1$ never match
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+}
+
+// allowedPath reports whether the path is under one of the prefixes.
+// An empty list of prefixes allows every path.
+func allowedPath(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func authHtpasswd(r *http.Request, path string) (username string, ok, allowed bool) {
+	username, password, found := r.BasicAuth()
+	if !found {
+		return "", false, false
+	}
+	users, _ := watch(path, parseHtpasswd).(htpasswd)
+	user, ok := users.authenticate(username, password)
+	if !ok {
+		return "", false, false
+	}
+	return username, true, allowedPath(user.prefixes, r.URL.Path)
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseHtpasswd(t *testing.T) {
+	parsed, err := parseHtpasswd([]byte("# comment\n\nalice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nbob:secret:/public/, /shared/\n"))
+
+	assert.Nil(t, err)
+	users := parsed.(htpasswd)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, []string{"/public/", "/shared/"}, users["bob"].prefixes)
+	assert.Nil(t, users["alice"].prefixes)
+}
+
+func TestParseInvalidHtpasswd(t *testing.T) {
+	_, err := parseHtpasswd([]byte("alice\n"))
+	assert.NotNil(t, err)
+}
+
+func TestVerifyBcryptPassword(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	assert.True(t, verifyPassword(string(hash), "password"))
+	assert.False(t, verifyPassword(string(hash), "wrong"))
+}
+
+func TestVerifySHAPassword(t *testing.T) {
+	hash := "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+
+	assert.True(t, verifyPassword(hash, "password"))
+	assert.False(t, verifyPassword(hash, "wrong"))
+}
+
+func TestVerifyPlainPassword(t *testing.T) {
+	assert.True(t, verifyPassword("password", "password"))
+	assert.False(t, verifyPassword("password", "passwor"))
+	assert.False(t, verifyPassword("$apr1$salt$hash", "$apr1$salt$hash"))
+}
+
+func TestAuthenticateUnknownUser(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(unknownUserHash))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+
+	users := htpasswd{"alice": {hash: "password"}}
+	_, ok := users.authenticate("bob", "password")
+	assert.False(t, ok)
+}
+
+func TestAllowedPath(t *testing.T) {
+	assert.True(t, allowedPath(nil, "/any"))
+	assert.True(t, allowedPath([]string{"/a/", "/b/"}, "/b/c"))
+	assert.False(t, allowedPath([]string{"/a/", "/b/"}, "/c/b/"))
+}
+
+func TestAuthHtpasswd(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "htpasswd")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".htpasswd")
+	ioutil.WriteFile(path, []byte("user:pass:/public/\n"), 0600) // nolint
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/public/file", nil)
+	req.SetBasicAuth("user", "pass")
+	username, ok, allowed := authHtpasswd(req, path)
+	assert.Equal(t, "user", username)
+	assert.True(t, ok)
+	assert.True(t, allowed)
+
+	req = httptest.NewRequest(http.MethodGet, sample, nil)
+	req.SetBasicAuth("user", "pass")
+	_, ok, allowed = authHtpasswd(req, path)
+	assert.True(t, ok)
+	assert.False(t, allowed)
+
+	req.SetBasicAuth("user", "wrong")
+	_, ok, _ = authHtpasswd(req, path)
+	assert.False(t, ok)
+}
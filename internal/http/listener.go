@@ -0,0 +1,113 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// The first file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+var (
+	systemdOnce      sync.Once
+	systemdListeners []net.Listener
+	systemdErr       error
+)
+
+// Listen returns the primary listener. It is inherited from systemd socket
+// activation if available, otherwise a Unix domain socket at APP_SOCKET or
+// a TCP socket on the address is opened.
+func Listen(addr string) (net.Listener, error) {
+	listener, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return withProxyProtocol(listener)
+}
+
+func listen(addr string) (net.Listener, error) {
+	listeners, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		return listeners[0], nil
+	}
+	if path := config.Config.Socket; len(path) > 0 {
+		return listenUnix(path, config.Config.SocketMode)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenHTTPS returns the listener for HTTPS running alongside plain HTTP.
+// It is the second socket passed by systemd if any, otherwise TCP on the address.
+func ListenHTTPS(addr string) (net.Listener, error) {
+	listeners, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 1 {
+		return withProxyProtocol(listeners[1])
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return withProxyProtocol(listener)
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	// Remove a socket left by a previous process
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// inheritedListeners returns the sockets passed by systemd socket activation
+// (see sd_listen_fds(3)), in the order they are configured in the unit.
+func inheritedListeners() ([]net.Listener, error) {
+	systemdOnce.Do(func() {
+		pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		if err != nil || pid != os.Getpid() {
+			return
+		}
+		fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || fds <= 0 {
+			return
+		}
+		os.Unsetenv("LISTEN_PID")     // nolint
+		os.Unsetenv("LISTEN_FDS")     // nolint
+		os.Unsetenv("LISTEN_FDNAMES") // nolint
+
+		for fd := listenFdsStart; fd < listenFdsStart+fds; fd++ {
+			file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+			listener, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				systemdErr = fmt.Errorf("systemd socket %d: %v", fd, err)
+				return
+			}
+			systemdListeners = append(systemdListeners, listener)
+		}
+	})
+	return systemdListeners, systemdErr
+}
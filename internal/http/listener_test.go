@@ -0,0 +1,48 @@
+package http
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "socket")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.sock")
+
+	listener, err := listenUnix(path, 0600)
+	assert.Nil(t, err)
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	go func(listener net.Listener) {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}(listener)
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err)
+	conn.Close()
+
+	// A stale socket is replaced
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	replaced, err := listenUnix(path, 0660)
+	assert.Nil(t, err)
+	replaced.Close()
+}
+
+func TestListenUnixOverRegularFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "socket")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	ioutil.WriteFile(path, []byte("data"), 0600) // nolint
+
+	_, err := listenUnix(path, 0600)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,309 @@
+package http
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie   = "s3proxy_session"
+	oidcStateCookie = "s3proxy_oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+type oidcProvider struct {
+	issuer       string
+	oauth2       oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	callbackPath string
+	secure       bool
+}
+
+type oidcSession struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Expiry  int64  `json:"exp"`
+}
+
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect"`
+	Expiry   int64  `json:"exp"`
+}
+
+var (
+	oidcMu     sync.Mutex
+	oidcCached *oidcProvider
+	sessionKey []byte
+)
+
+// authOIDC makes sure the request belongs to a signed-in user.
+// It returns false when it has already written a response.
+func authOIDC(w http.ResponseWriter, r *http.Request) (string, bool) {
+	p, err := getOIDCProvider()
+	if err != nil {
+		log.Printf("[oidc] %v", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return "", false
+	}
+	if r.URL.Path == p.callbackPath {
+		p.callback(w, r)
+		return "", false
+	}
+	session := oidcSession{}
+	if err := readSecureCookie(r, sessionCookie, &session); err == nil &&
+		time.Now().Unix() < session.Expiry {
+		if len(session.Email) > 0 {
+			return session.Email, true
+		}
+		return session.Subject, true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return "", false
+	}
+	state := oidcState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Redirect: r.URL.RequestURI(),
+		Expiry:   time.Now().Add(oidcStateTTL).Unix(),
+	}
+	if err := writeSecureCookie(w, oidcStateCookie, state, oidcStateTTL, p.secure); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	http.Redirect(w, r, p.oauth2.AuthCodeURL(state.State, oidc.Nonce(state.Nonce)), http.StatusFound)
+	return "", false
+}
+
+func (p *oidcProvider) callback(w http.ResponseWriter, r *http.Request) {
+	state := oidcState{}
+	if err := readSecureCookie(r, oidcStateCookie, &state); err != nil ||
+		time.Now().Unix() >= state.Expiry || state.State != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid OpenID Connect state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/", MaxAge: -1})
+
+	if reason := r.URL.Query().Get("error"); len(reason) > 0 {
+		http.Error(w, reason, http.StatusUnauthorized)
+		return
+	}
+	token, err := p.oauth2.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("[oidc] %v", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Missing id_token", http.StatusUnauthorized)
+		return
+	}
+	idToken, err := p.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != state.Nonce {
+		log.Printf("[oidc] invalid id_token: %v", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	claims := map[string]interface{}{}
+	if err = idToken.Claims(&claims); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	email, _ := claims["email"].(string)
+	if verified, found := claims["email_verified"].(bool); found && !verified {
+		email = ""
+	}
+	if !oidcAuthorized(email, claimStrings(claims[config.Config.OidcGroupsClaim])) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	ttl := config.Config.OidcSessionTTL
+	session := oidcSession{
+		Subject: idToken.Subject,
+		Email:   email,
+		Expiry:  time.Now().Add(ttl).Unix(),
+	}
+	if err = writeSecureCookie(w, sessionCookie, session, ttl, p.secure); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirect := state.Redirect
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		redirect = "/"
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcAuthorized checks the email domain and groups against the allowed lists.
+// A user is allowed when no list is configured or either of them matches.
+func oidcAuthorized(email string, groups []string) bool {
+	domains := SplitList(config.Config.OidcAllowedDomains)
+	allowedGroups := SplitList(config.Config.OidcAllowedGroups)
+	if len(domains) == 0 && len(allowedGroups) == 0 {
+		return true
+	}
+	if at := strings.LastIndex(email, "@"); at > -1 {
+		for _, domain := range domains {
+			if strings.EqualFold(email[at+1:], domain) {
+				return true
+			}
+		}
+	}
+	for _, group := range groups {
+		for _, allowed := range allowedGroups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		result := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func getOIDCProvider() (*oidcProvider, error) {
+	c := config.Config
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcCached != nil && oidcCached.issuer == c.OidcIssuer {
+		return oidcCached, nil
+	}
+	// Keys are fetched lazily with this context, so it must outlive the request
+	provider, err := oidc.NewProvider(context.Background(), c.OidcIssuer)
+	if err != nil {
+		return nil, err
+	}
+	redirect, err := url.Parse(c.OidcRedirectURL)
+	if err != nil {
+		return nil, err
+	}
+	oidcCached = &oidcProvider{
+		issuer: c.OidcIssuer,
+		oauth2: oauth2.Config{
+			ClientID:     c.OidcClientID,
+			ClientSecret: c.OidcClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  c.OidcRedirectURL,
+			Scopes:       SplitList(c.OidcScopes),
+		},
+		verifier:     provider.Verifier(&oidc.Config{ClientID: c.OidcClientID}),
+		callbackPath: redirect.Path,
+		secure:       redirect.Scheme == "https",
+	}
+	return oidcCached, nil
+}
+
+func getSessionKey() []byte {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if secret := config.Config.OidcSessionSecret; len(secret) > 0 {
+		sum := sha256.Sum256([]byte(secret))
+		return sum[:]
+	}
+	if sessionKey == nil {
+		log.Print("[oidc] OIDC_SESSION_SECRET is not set, sessions will not survive restarts")
+		sessionKey = make([]byte, 32)
+		rand.Read(sessionKey) // nolint
+	}
+	return sessionKey
+}
+
+func writeSecureCookie(w http.ResponseWriter, name string, value interface{}, ttl time.Duration, secure bool) error {
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(name))
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(sealed),
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func readSecureCookie(r *http.Request, name string, value interface{}) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher()
+	if err != nil {
+		return err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return errors.New("malformed cookie")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, value)
+}
+
+func sessionCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(getSessionKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b) // nolint
+	return hex.EncodeToString(b)
+}
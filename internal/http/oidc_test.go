@@ -0,0 +1,172 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// issuer is a stand-in OpenID Connect provider
+type issuer struct {
+	*httptest.Server
+	nonce string
+	email string
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	i := &issuer{email: "alice@example.com"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint
+			"issuer":                 i.URL,
+			"authorization_endpoint": i.URL + "/auth",
+			"token_endpoint":         i.URL + "/token",
+			"jwks_uri":               i.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ // nolint
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+			(&jose.SignerOptions{}).WithHeader("kid", "test"))
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss":   i.URL,
+			"sub":   "alice",
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": i.nonce,
+			"email": i.email,
+		})
+		signed, _ := signer.Sign(claims)
+		idToken, _ := signed.CompactSerialize()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+	i.Server = httptest.NewServer(mux)
+	return i
+}
+
+func setupOIDC(i *issuer, domains string) {
+	c := config.Config
+	c.OidcIssuer = i.URL
+	c.OidcClientID = "client"
+	c.OidcClientSecret = "secret"
+	c.OidcRedirectURL = "http://example.com/oauth2/callback"
+	c.OidcAllowedDomains = domains
+	c.OidcSessionSecret = "session-secret"
+	c.JwtSecretKey = ""
+}
+
+func signIn(t *testing.T, i *issuer, handler http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sample, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	login, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, i.URL+"/auth", login.Scheme+"://"+login.Host+login.Path)
+	i.nonce = login.Query().Get("nonce")
+
+	callback := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?code=abc&state="+
+		login.Query().Get("state"), nil)
+	for _, cookie := range w.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, callback)
+	return w
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	i := newIssuer(t)
+	defer i.Close()
+	setupOIDC(i, "example.com")
+	defer func() { config.Config.OidcIssuer = "" }()
+
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok")) // nolint
+	})
+	w := signIn(t, i, handler)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/foo", w.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			req.AddCookie(cookie)
+		}
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestOIDCDisallowedDomain(t *testing.T) {
+	i := newIssuer(t)
+	defer i.Close()
+	setupOIDC(i, "example.org")
+	defer func() { config.Config.OidcIssuer = "" }()
+
+	w := signIn(t, i, WrapHandler(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestOIDCInvalidState(t *testing.T) {
+	i := newIssuer(t)
+	defer i.Close()
+	setupOIDC(i, "")
+	defer func() { config.Config.OidcIssuer = "" }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/oauth2/callback?code=abc&state=x", nil)
+	WrapHandler(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOIDCAuthorized(t *testing.T) {
+	config.Config.OidcAllowedDomains = "example.com"
+	config.Config.OidcAllowedGroups = "admins, docs"
+	defer func() {
+		config.Config.OidcAllowedDomains = ""
+		config.Config.OidcAllowedGroups = ""
+	}()
+	assert.True(t, oidcAuthorized("bob@EXAMPLE.com", nil))
+	assert.True(t, oidcAuthorized("bob@example.org", []string{"docs"}))
+	assert.False(t, oidcAuthorized("bob@example.org", []string{"other"}))
+}
+
+func TestSecureCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	assert.Nil(t, writeSecureCookie(w, "test", oidcSession{Subject: "alice"}, time.Minute, false))
+
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	session := oidcSession{}
+	assert.Nil(t, readSecureCookie(req, "test", &session))
+	assert.Equal(t, "alice", session.Subject)
+
+	// A cookie sealed for another name must not be accepted
+	req = httptest.NewRequest(http.MethodGet, sample, nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: w.Result().Cookies()[0].Value})
+	assert.NotNil(t, readSecureCookie(req, sessionCookie, &session))
+}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+const proxyHeaderTimeout = 10 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolListener reads PROXY protocol v1/v2 headers on accepted connections
+// from trusted sources and reports the original client as their remote address
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	unix    bool
+}
+
+// withProxyProtocol refuses to trust every source, as anyone connecting
+// directly could then claim any address
+func withProxyProtocol(listener net.Listener) (net.Listener, error) {
+	c := config.Config
+	if !c.ProxyProtocol {
+		return listener, nil
+	}
+	trusted := parseCIDRs(c.ProxyProtocolTrusted)
+	unix := trustsUnixPeers(c.ProxyProtocolTrusted)
+	if len(trusted) == 0 && !unix {
+		listener.Close()
+		return nil, errors.New("PROXY_PROTOCOL requires PROXY_PROTOCOL_TRUSTED_CIDRS")
+	}
+	return &proxyProtocolListener{Listener: listener, trusted: trusted, unix: unix}, nil
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, trusted: l.trusted, unix: l.unix}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	trusted []*net.IPNet
+	unix    bool
+	once    sync.Once
+	reader  io.Reader
+	remote  net.Addr
+	err     error
+}
+
+// trustedSource reports whether the peer may send a PROXY protocol header
+func (c *proxyConn) trustedSource() bool {
+	if _, ok := c.Conn.LocalAddr().(*net.UnixAddr); ok {
+		return c.unix
+	}
+	source := c.Conn.RemoteAddr()
+	return source != nil && containsIP(c.trusted, parseHostIP(source.String()))
+}
+
+// init reads the header lazily, so that a slow client does not block Accept
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.reader = c.Conn
+		if !c.trustedSource() {
+			return
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)) // nolint
+		defer c.Conn.SetReadDeadline(time.Time{})                  // nolint
+
+		reader := bufio.NewReader(c.Conn)
+		c.reader = reader
+		c.remote, c.err = readProxyHeader(reader)
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader returns the source address in the header. It returns
+// nil without error when there is no header or it carries no address.
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	if peek, err := reader.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(peek, proxyV2Signature) {
+		return readProxyHeaderV2(reader)
+	}
+	if peek, err := reader.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(peek, proxyV1Prefix) {
+		return readProxyHeaderV1(reader)
+	}
+	return nil, nil
+}
+
+// PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func readProxyHeaderV1(reader *bufio.Reader) (net.Addr, error) {
+	line := []byte{}
+	for len(line) < 107 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxy protocol: malformed v1 header")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxy protocol: malformed v1 header: %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("proxy protocol: invalid source %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("proxy protocol: unsupported version")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	// LOCAL command, e.g. health checks of the load balancer itself
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("proxy protocol: short v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("proxy protocol: short v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
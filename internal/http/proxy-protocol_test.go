@@ -0,0 +1,175 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadProxyHeaderV1(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+	addr, err := readProxyHeader(reader)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:56324", addr.String())
+	rest, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+}
+
+func TestReadProxyHeaderV1Unknown(t *testing.T) {
+	addr, err := readProxyHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+
+	assert.Nil(t, err)
+	assert.Nil(t, addr)
+}
+
+func TestReadMalformedProxyHeaderV1(t *testing.T) {
+	_, err := readProxyHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1\r\n")))
+	assert.NotNil(t, err)
+}
+
+func proxyHeaderV2(command, family byte, address []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(address)))
+	return append(header, address...)
+}
+
+func TestReadProxyHeaderV2(t *testing.T) {
+	address := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	data := string(proxyHeaderV2(1, 0x11, address)) + "GET / HTTP/1.1\r\n"
+	reader := bufio.NewReader(strings.NewReader(data))
+	addr, err := readProxyHeader(reader)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:56324", addr.String())
+	rest, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+}
+
+func TestReadProxyHeaderV2Local(t *testing.T) {
+	addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(string(proxyHeaderV2(0, 0, nil)))))
+
+	assert.Nil(t, err)
+	assert.Nil(t, addr)
+}
+
+func TestReadWithoutProxyHeader(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	addr, err := readProxyHeader(reader)
+
+	assert.Nil(t, err)
+	assert.Nil(t, addr)
+	rest, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	config.Config.ProxyProtocol = true
+	config.Config.ProxyProtocolTrusted = "127.0.0.1"
+	defer func() {
+		config.Config.ProxyProtocol = false
+		config.Config.ProxyProtocolTrusted = ""
+	}()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener, err := withProxyProtocol(inner)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err == nil {
+			conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello")) // nolint
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+	body, _ := ioutil.ReadAll(conn)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestProxyProtocolWithoutTrustedSources(t *testing.T) {
+	config.Config.ProxyProtocol = true
+	defer func() { config.Config.ProxyProtocol = false }()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	_, err = withProxyProtocol(inner)
+	assert.NotNil(t, err)
+}
+
+func TestProxyProtocolFromUntrustedSource(t *testing.T) {
+	config.Config.ProxyProtocol = true
+	config.Config.ProxyProtocolTrusted = "10.0.0.0/8"
+	defer func() {
+		config.Config.ProxyProtocol = false
+		config.Config.ProxyProtocolTrusted = ""
+	}()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener, err := withProxyProtocol(inner)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err == nil {
+			conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")) // nolint
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// The header is left as it is, and the spoofed address is ignored
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+	body, _ := ioutil.ReadAll(conn)
+	assert.Equal(t, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", string(body))
+}
+
+func TestProxyProtocolOnUnixSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "socket")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.sock")
+
+	config.Config.ProxyProtocol = true
+	config.Config.ProxyProtocolTrusted = "unix"
+	defer func() {
+		config.Config.ProxyProtocol = false
+		config.Config.ProxyProtocolTrusted = ""
+	}()
+
+	inner, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	listener, err := withProxyProtocol(inner)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")) // nolint
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+}
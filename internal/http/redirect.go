@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// PlainHTTPHandler returns the handler for the plain HTTP listener that runs
+// alongside HTTPS. It answers ACME challenges and the health check, and
+// redirects other requests to HTTPS if HTTP_REDIRECT_TO_HTTPS is enabled.
+func PlainHTTPHandler(next http.Handler) http.Handler {
+	if !config.Config.HTTPRedirectToHTTPS {
+		return ACMEHTTPHandler(next)
+	}
+	return ACMEHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := config.Config
+		if len(c.HealthCheckPath) > 0 && r.URL.Path == c.HealthCheckPath {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, httpsURL(r), http.StatusMovedPermanently)
+	}))
+}
+
+func httpsURL(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := config.Config.HTTPSPort; len(port) > 0 && port != "443" {
+		host = net.JoinHostPort(host, port)
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
+
+// hstsHeader returns the value of Strict-Transport-Security
+func hstsHeader() string {
+	c := config.Config
+	if c.HstsMaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.FormatInt(c.HstsMaxAge, 10)
+	if c.HstsIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if c.HstsPreload {
+		value += "; preload"
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainHTTPHandlerWithoutRedirect(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	PlainHTTPHandler(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, sample, nil))
+
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestPlainHTTPHandlerWithRedirect(t *testing.T) {
+	c := config.Config
+	c.HTTPRedirectToHTTPS = true
+	c.HTTPSPort = "8443"
+	c.HealthCheckPath = "/health"
+	defer func() {
+		c.HTTPRedirectToHTTPS = false
+		c.HTTPSPort = ""
+		c.HealthCheckPath = ""
+	}()
+	handler := PlainHTTPHandler(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/foo?a=b", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://example.com:8443/foo?a=b", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	c.HTTPSPort = "443"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil))
+	assert.Equal(t, "https://example.com/foo", w.Header().Get("Location"))
+}
+
+func TestHSTSHeader(t *testing.T) {
+	c := config.Config
+	c.HstsMaxAge = 31536000
+	c.HstsIncludeSubdomains = true
+	c.HstsPreload = true
+	defer func() {
+		c.HstsMaxAge = 0
+		c.HstsIncludeSubdomains = false
+		c.HstsPreload = false
+	}()
+	handler := WrapHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, sample, nil))
+	assert.Equal(t, "", w.Header().Get("Strict-Transport-Security"))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, sample, nil)
+	req.TLS = &tls.ConnectionState{}
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "max-age=31536000; includeSubDomains; preload", w.Header().Get("Strict-Transport-Security"))
+}
@@ -22,3 +22,10 @@ func (c *custom) WriteHeader(status int) {
 	c.ResponseWriter.WriteHeader(status)
 	c.status = status
 }
+
+// Flush sends the buffered body to the client, for handlers streaming a response
+func (c *custom) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"golang.org/x/crypto/acme"
+)
+
+// Client certificate verification modes
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// TLSEnabled reports whether the listener serves TLS
+func TLSEnabled() bool {
+	c := config.Config
+	return ((len(c.SslCert) > 0) && (len(c.SslKey) > 0)) || ACMEEnabled()
+}
+
+// TLSConfig returns the TLS configuration for the listener.
+// Certificates in SSL_CERT_PATH and SSL_KEY_PATH are reloaded when they change.
+func TLSConfig() (*tls.Config, error) {
+	c := config.Config
+
+	certs, err := newCertStore(SplitList(c.SslCert), SplitList(c.SslKey))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{GetCertificate: certs.getCertificate}
+
+	if ACMEEnabled() {
+		manager := getACMEManager()
+		cfg.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if len(certs.pairs) == 0 || acmeHost(hello.ServerName) {
+				return manager.GetCertificate(hello)
+			}
+			return certs.getCertificate(hello)
+		}
+	}
+
+	if len(c.TLSMinVersion) > 0 {
+		version, found := tlsVersions[c.TLSMinVersion]
+		if !found {
+			return nil, errors.New("unknown TLS_MIN_VERSION: " + c.TLSMinVersion)
+		}
+		cfg.MinVersion = version
+	}
+	for _, name := range SplitList(c.TLSCipherSuites) {
+		suite, found := cipherSuites[strings.ToUpper(name)]
+		if !found {
+			return nil, errors.New("unknown TLS cipher suite: " + name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, suite)
+	}
+	if len(c.SslClientCA) > 0 {
+		pem, err := ioutil.ReadFile(c.SslClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + c.SslClientCA)
+		}
+		cfg.ClientCAs = pool
+
+		switch strings.ToLower(c.SslClientAuth) {
+		case ClientAuthRequire:
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthVerifyIfGiven:
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, errors.New("unknown SSL_CLIENT_AUTH: " + c.SslClientAuth)
+		}
+	}
+	return cfg, nil
+}
+
+type certPair struct {
+	certFile, keyFile string
+	modTime           time.Time
+	cert              *tls.Certificate
+}
+
+// certStore holds certificate pairs and selects one of them by SNI
+type certStore struct {
+	mu      sync.Mutex
+	pairs   []*certPair
+	checked time.Time
+}
+
+func newCertStore(certFiles, keyFiles []string) (*certStore, error) {
+	if len(certFiles) != len(keyFiles) {
+		return nil, fmt.Errorf("%d certificates but %d keys are specified", len(certFiles), len(keyFiles))
+	}
+	store := &certStore{}
+	for i := range certFiles {
+		pair := &certPair{certFile: certFiles[i], keyFile: keyFiles[i]}
+		if err := pair.load(); err != nil {
+			return nil, err
+		}
+		store.pairs = append(store.pairs, pair)
+	}
+	store.checked = time.Now()
+	return store, nil
+}
+
+func (p *certPair) load() error {
+	modTime, err := latestModTime(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	if p.cert != nil && modTime.Equal(p.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+	if p.cert != nil {
+		log.Printf("[tls] %s reloaded", p.certFile)
+	}
+	p.cert = &cert
+	p.modTime = modTime
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (s *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) >= watchInterval {
+		s.checked = time.Now()
+		for _, pair := range s.pairs {
+			// Keep serving the previous certificate while files are being replaced
+			if err := pair.load(); err != nil {
+				log.Printf("[tls] %s: %v", pair.certFile, err)
+			}
+		}
+	}
+	if len(s.pairs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	if len(hello.ServerName) > 0 {
+		for _, pair := range s.pairs {
+			if pair.cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return pair.cert, nil
+			}
+		}
+	}
+	return s.pairs[0].cert, nil
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a self-signed certificate and its key into the directory
+func writeCert(t *testing.T, dir, name string, hosts ...string) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              hosts,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)      // nolint
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600) // nolint
+	return certFile, keyFile
+}
+
+func TestTLSConfigWithClientCA(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ca")
+	defer os.RemoveAll(dir)
+	path, _ := writeCert(t, dir, "ca")
+
+	c := config.Config
+	c.SslClientCA = path
+	defer func() {
+		c.SslClientCA = ""
+		c.SslClientAuth = ClientAuthRequire
+	}()
+	cfg, err := TLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	c.SslClientAuth = ClientAuthVerifyIfGiven
+	cfg, err = TLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+	c.SslClientAuth = "unknown"
+	_, err = TLSConfig()
+	assert.NotNil(t, err)
+}
+
+func TestTLSConfigVersionAndCiphers(t *testing.T) {
+	c := config.Config
+	c.TLSMinVersion = "1.2"
+	c.TLSCipherSuites = "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,tls_ecdhe_ecdsa_with_aes_256_gcm_sha384"
+	defer func() {
+		c.TLSMinVersion = ""
+		c.TLSCipherSuites = ""
+	}()
+	cfg, err := TLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Equal(t, []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}, cfg.CipherSuites)
+
+	c.TLSMinVersion = "2.0"
+	_, err = TLSConfig()
+	assert.NotNil(t, err)
+}
+
+func TestCertStoreSNI(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sni")
+	defer os.RemoveAll(dir)
+	certA, keyA := writeCert(t, dir, "a", "a.example.com")
+	certB, keyB := writeCert(t, dir, "b", "*.b.example.com")
+
+	store, err := newCertStore([]string{certA, certB}, []string{keyA, keyB})
+	assert.Nil(t, err)
+
+	cert, _ := store.getCertificate(&tls.ClientHelloInfo{ServerName: "www.b.example.com"})
+	assert.Equal(t, "b", cert.Leaf.Subject.CommonName)
+
+	cert, _ = store.getCertificate(&tls.ClientHelloInfo{ServerName: "unknown.example.com"})
+	assert.Equal(t, "a", cert.Leaf.Subject.CommonName)
+
+	_, err = newCertStore([]string{certA, certB}, []string{keyA})
+	assert.NotNil(t, err)
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "reload")
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir, "a", "a.example.com")
+
+	store, err := newCertStore([]string{certFile}, []string{keyFile})
+	assert.Nil(t, err)
+	before, _ := store.getCertificate(&tls.ClientHelloInfo{})
+
+	writeCert(t, dir, "a", "a.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future) // nolint
+	store.checked = time.Time{}
+
+	after, _ := store.getCertificate(&tls.ClientHelloInfo{})
+	assert.NotEqual(t, before.Leaf.SerialNumber, after.Leaf.SerialNumber)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often a watched file is checked for modifications
+const watchInterval = time.Second
+
+type watchedFile struct {
+	path    string
+	parse   func([]byte) (interface{}, error)
+	mu      sync.Mutex
+	checked time.Time
+	modTime time.Time
+	size    int64
+	value   interface{}
+}
+
+var (
+	watchedFilesMu sync.Mutex
+	watchedFiles   = map[string]*watchedFile{}
+)
+
+// watch returns the parsed contents of the file, re-reading it when it has changed.
+// If the file cannot be read or parsed, the last successfully parsed value is kept.
+func watch(path string, parse func([]byte) (interface{}, error)) interface{} {
+	watchedFilesMu.Lock()
+	f, ok := watchedFiles[path]
+	if !ok {
+		f = &watchedFile{path: path, parse: parse}
+		watchedFiles[path] = f
+	}
+	watchedFilesMu.Unlock()
+	return f.load()
+}
+
+func (f *watchedFile) load() interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.checked.IsZero() && time.Since(f.checked) < watchInterval {
+		return f.value
+	}
+	f.checked = time.Now()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("[watch] %s: %v", f.path, err)
+		return f.value
+	}
+	if f.value != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		log.Printf("[watch] %s: %v", f.path, err)
+		return f.value
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		log.Printf("[watch] %s: %v", f.path, err)
+		return f.value
+	}
+	if f.value != nil {
+		log.Printf("[watch] %s reloaded", f.path)
+	}
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.value = value
+	return f.value
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// S3CertCache stores ACME certificates and account keys in Amazon S3
+type S3CertCache struct {
+	Bucket string
+	Prefix string
+	Region *string
+}
+
+// Get returns a cached certificate data
+func (c S3CertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	obj, err := s3.New(awsSession(c.Region)).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(path.Join(c.Prefix, name)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, autocert.ErrCacheMiss
+		}
+		return nil, err
+	}
+	defer obj.Body.Close()
+	return ioutil.ReadAll(obj.Body)
+}
+
+// Put stores certificate data
+func (c S3CertCache) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s3.New(awsSession(c.Region)).PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(c.Bucket),
+		Key:                  aws.String(path.Join(c.Prefix, name)),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	return err
+}
+
+// Delete removes certificate data
+func (c S3CertCache) Delete(ctx context.Context, name string) error {
+	_, err := s3.New(awsSession(c.Region)).DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(path.Join(c.Prefix, name)),
+	})
+	return err
+}
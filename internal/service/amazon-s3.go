@@ -8,6 +8,9 @@ import (
 
 // S3get returns a specified object from Amazon S3
 func (c client) S3get(bucket, key string, rangeHeader *string) (*s3.GetObjectOutput, error) {
+	if rangeHeader == nil && config.Config.ParallelGetThreshold > 0 {
+		return c.s3getParallel(bucket, key)
+	}
 	req := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -16,28 +19,66 @@ func (c client) S3get(bucket, key string, rangeHeader *string) (*s3.GetObjectOut
 	return s3.New(c.Session).GetObjectWithContext(c.Context, req)
 }
 
-// S3listObjects returns a list of s3 objects
-func (c client) S3listObjects(bucket, prefix string) (*s3.ListObjectsOutput, error) {
-	req := &s3.ListObjectsInput{
-		Bucket:    aws.String(bucket),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
+// S3getIfMatch returns a part of the object only if it still has the ETag
+func (c client) S3getIfMatch(bucket, key string, rangeHeader, eTag *string) (*s3.GetObjectOutput, error) {
+	req := &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   rangeHeader,
+		IfMatch: eTag,
+	}
+	return s3.New(c.Session).GetObjectWithContext(c.Context, req)
+}
+
+// S3head returns metadata of a specified object
+func (c client) S3head(bucket, key string) (*s3.HeadObjectOutput, error) {
+	req := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	return s3.New(c.Session).HeadObjectWithContext(c.Context, req)
+}
+
+// S3listObjects returns a page of s3 objects. With GET_ALL_PAGES_IN_DIR,
+// all pages are returned unless a page size or a continuation is requested.
+func (c client) S3listObjects(bucket, prefix string, maxKeys int64, continuationToken *string) (*s3.ListObjectsV2Output, error) {
+	req := &s3.ListObjectsV2Input{
+		Bucket:            aws.String(bucket),
+		Prefix:            aws.String(prefix),
+		Delimiter:         aws.String("/"),
+		ContinuationToken: continuationToken,
+	}
+	if maxKeys > 0 {
+		req.MaxKeys = aws.Int64(maxKeys)
 	}
 	// List 1000 records
-	if !config.Config.AllPagesInDir {
-		return s3.New(c.Session).ListObjectsWithContext(c.Context, req)
+	if !config.Config.AllPagesInDir || maxKeys > 0 || continuationToken != nil {
+		return s3.New(c.Session).ListObjectsV2WithContext(c.Context, req)
 	}
 	// List all objects with pagenation
-	result := &s3.ListObjectsOutput{
+	result := &s3.ListObjectsV2Output{
 		CommonPrefixes: []*s3.CommonPrefix{},
 		Contents:       []*s3.Object{},
 		Prefix:         aws.String(prefix),
 	}
-	err := s3.New(c.Session).ListObjectsPagesWithContext(c.Context, req,
-		func(page *s3.ListObjectsOutput, lastPage bool) bool {
+	err := s3.New(c.Session).ListObjectsV2PagesWithContext(c.Context, req,
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
 			result.CommonPrefixes = append(result.CommonPrefixes, page.CommonPrefixes...)
 			result.Contents = append(result.Contents, page.Contents...)
-			return len(page.Contents) == 1000
+			return true
 		})
 	return result, err
 }
+
+// S3walkObjects calls fn with each page of all objects under the prefix,
+// including ones in its subdirectories, until fn returns false
+func (c client) S3walkObjects(bucket, prefix string, fn func(page *s3.ListObjectsV2Output) bool) error {
+	req := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	return s3.New(c.Session).ListObjectsV2PagesWithContext(c.Context, req,
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			return fn(page)
+		})
+}
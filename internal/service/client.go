@@ -10,7 +10,10 @@ import (
 // AWS is a service to interact with original AWS services
 type AWS interface {
 	S3get(bucket, key string, rangeHeader *string) (*s3.GetObjectOutput, error)
-	S3listObjects(bucket, prefix string) (*s3.ListObjectsOutput, error)
+	S3getIfMatch(bucket, key string, rangeHeader, eTag *string) (*s3.GetObjectOutput, error)
+	S3head(bucket, key string) (*s3.HeadObjectOutput, error)
+	S3listObjects(bucket, prefix string, maxKeys int64, continuationToken *string) (*s3.ListObjectsV2Output, error)
+	S3walkObjects(bucket, prefix string, fn func(page *s3.ListObjectsV2Output) bool) error
 }
 
 type client struct {
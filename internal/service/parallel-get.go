@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+)
+
+// getObjectFunc is GetObjectWithContext of the S3 client
+type getObjectFunc func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+
+// s3getParallel fetches the first part of the object, and if the object
+// turns out to be larger than the threshold, the rest of it as concurrent
+// ranged GETs. The parts are streamed in order, buffering at most as many
+// of them as can be in flight. The rest of smaller objects is streamed
+// from a single GET.
+func (c client) s3getParallel(bucket, key string) (*s3.GetObjectOutput, error) {
+	svc := s3.New(c.Session)
+	return getParallel(c.Context, func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		return svc.GetObjectWithContext(ctx, input)
+	}, bucket, key)
+}
+
+func getParallel(ctx context.Context, get getObjectFunc, bucket, key string) (*s3.GetObjectOutput, error) {
+	cfg := config.Config
+
+	first, err := get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", cfg.ParallelGetPartSize-1)),
+	})
+	if err != nil {
+		// e.g. an empty object has no byte to satisfy the range
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidRange" {
+			return get(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+			})
+		}
+		return nil, err
+	}
+	size, err := totalSize(first.ContentRange)
+	if err != nil {
+		first.Body.Close()
+		return nil, err
+	}
+	firstLength := aws.Int64Value(first.ContentLength)
+
+	// Every part must come from the same version of the object
+	getRange := func(ctx context.Context, rangeHeader string) (*s3.GetObjectOutput, error) {
+		return get(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(key),
+			Range:   aws.String(rangeHeader),
+			IfMatch: first.ETag,
+		})
+	}
+	switch {
+	case size <= firstLength:
+	case size <= cfg.ParallelGetThreshold:
+		// Smaller objects are streamed with another GET of the rest
+		rest, err := getRange(ctx, fmt.Sprintf("bytes=%d-", firstLength))
+		if err != nil {
+			first.Body.Close()
+			return nil, err
+		}
+		first.Body = &concatReader{Reader: io.MultiReader(first.Body, rest.Body), bodies: []io.Closer{first.Body, rest.Body}}
+	default:
+		fetch := func(ctx context.Context, rangeHeader string) ([]byte, error) {
+			obj, err := getRange(ctx, rangeHeader)
+			if err != nil {
+				return nil, err
+			}
+			defer obj.Body.Close()
+			buf := bytes.NewBuffer(make([]byte, 0, aws.Int64Value(obj.ContentLength)))
+			_, err = buf.ReadFrom(obj.Body)
+			return buf.Bytes(), err
+		}
+		parts := planParts(firstLength, size, cfg.ParallelGetPartSize)
+		first.Body = newParallelReader(ctx, first.Body, parts, cfg.ParallelGetConcurrency, fetch)
+	}
+	first.ContentLength = aws.Int64(size)
+	first.ContentRange = nil
+	return first, nil
+}
+
+// planParts splits the object from the offset to the end into ranges of the part size
+func planParts(offset, size, partSize int64) []string {
+	parts := []string{}
+	for ; offset < size; offset += partSize {
+		last := offset + partSize - 1
+		if last >= size {
+			last = size - 1
+		}
+		parts = append(parts, fmt.Sprintf("bytes=%d-%d", offset, last))
+	}
+	return parts
+}
+
+// concatReader reads the bodies one after another, and closes all of them
+type concatReader struct {
+	io.Reader
+	bodies []io.Closer
+}
+
+func (c *concatReader) Close() error {
+	var err error
+	for _, body := range c.bodies {
+		if closeErr := body.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// totalSize returns the complete length in "bytes 0-99/1234"
+func totalSize(contentRange *string) (int64, error) {
+	value := aws.StringValue(contentRange)
+	idx := strings.LastIndex(value, "/")
+	if idx < 0 {
+		return 0, fmt.Errorf("unexpected Content-Range: %q", value)
+	}
+	return strconv.ParseInt(value[idx+1:], 10, 64)
+}
+
+type partResult struct {
+	data []byte
+	err  error
+}
+
+// parallelReader reads the first body and then the parts in order,
+// keeping up to `concurrency` of them in flight
+type parallelReader struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	fetch       func(ctx context.Context, rangeHeader string) ([]byte, error)
+	parts       []string
+	concurrency int
+	pending     []chan partResult
+	current     io.Reader
+	first       io.ReadCloser
+	err         error
+}
+
+func newParallelReader(ctx context.Context, first io.ReadCloser, parts []string, concurrency int,
+	fetch func(ctx context.Context, rangeHeader string) ([]byte, error)) *parallelReader {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		ctx:         ctx,
+		cancel:      cancel,
+		fetch:       fetch,
+		parts:       parts,
+		concurrency: concurrency,
+		current:     first,
+		first:       first,
+	}
+	r.start()
+	return r
+}
+
+// start fetches the next parts until the window is full
+func (r *parallelReader) start() {
+	for len(r.parts) > 0 && len(r.pending) < r.concurrency {
+		result := make(chan partResult, 1)
+		go func(rangeHeader string) {
+			data, err := r.fetch(r.ctx, rangeHeader)
+			result <- partResult{data: data, err: err}
+		}(r.parts[0])
+		r.parts = r.parts[1:]
+		r.pending = append(r.pending, result)
+	}
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		n, err := r.current.Read(p)
+		if err != io.EOF {
+			if err != nil {
+				r.fail(err)
+			}
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		// The part just read is released before another one is fetched,
+		// so that no more than `concurrency` parts are held at once
+		r.current = eofReader{}
+		r.start()
+		if len(r.pending) == 0 {
+			return 0, io.EOF
+		}
+		result := <-r.pending[0]
+		r.pending = r.pending[1:]
+		if result.err != nil {
+			r.fail(result.err)
+			break
+		}
+		r.current = bytes.NewReader(result.data)
+	}
+	return 0, r.err
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (r *parallelReader) fail(err error) {
+	r.err = err
+	r.cancel()
+}
+
+// Close stops fetching the parts in flight
+func (r *parallelReader) Close() error {
+	r.cancel()
+	return r.first.Close()
+}
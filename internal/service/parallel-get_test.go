@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pottava/aws-s3-proxy/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func fetchFrom(content string, inFlight, maxInFlight *int32) func(context.Context, string) ([]byte, error) {
+	return func(ctx context.Context, rangeHeader string) ([]byte, error) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+		var first, last int
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &first, &last); err != nil {
+			return nil, err
+		}
+		return []byte(content[first : last+1]), nil
+	}
+}
+
+func TestParallelReader(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	parts := []string{}
+	for offset := 10; offset < len(content); offset += 7 {
+		last := offset + 6
+		if last >= len(content) {
+			last = len(content) - 1
+		}
+		parts = append(parts, fmt.Sprintf("bytes=%d-%d", offset, last))
+	}
+	var inFlight, maxInFlight int32
+	r := newParallelReader(context.Background(), ioutil.NopCloser(strings.NewReader(content[:10])),
+		parts, 3, fetchFrom(content, &inFlight, &maxInFlight))
+	defer r.Close()
+
+	actual, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(actual))
+	assert.True(t, maxInFlight <= 3)
+}
+
+func TestParallelReaderError(t *testing.T) {
+	fetch := func(ctx context.Context, rangeHeader string) ([]byte, error) {
+		if rangeHeader == "bytes=4-5" {
+			return nil, errors.New("PreconditionFailed")
+		}
+		return []byte("xx"), nil
+	}
+	r := newParallelReader(context.Background(), ioutil.NopCloser(strings.NewReader("ab")),
+		[]string{"bytes=2-3", "bytes=4-5", "bytes=6-7"}, 2, fetch)
+	defer r.Close()
+
+	actual, err := ioutil.ReadAll(r)
+	assert.EqualError(t, err, "PreconditionFailed")
+	assert.Equal(t, "abxx", string(actual))
+}
+
+// getFrom serves the content with ranges, recording the requested ones
+func getFrom(content string, requested *[]string) getObjectFunc {
+	var mu sync.Mutex
+	return func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		rangeHeader := aws.StringValue(input.Range)
+		mu.Lock()
+		*requested = append(*requested, rangeHeader)
+		mu.Unlock()
+
+		obj := &s3.GetObjectOutput{ETag: aws.String(`"etag"`)}
+		if input.IfMatch != nil && aws.StringValue(input.IfMatch) != `"etag"` {
+			return nil, awserr.New("PreconditionFailed", "precondition failed", nil)
+		}
+		if len(rangeHeader) == 0 {
+			obj.Body = ioutil.NopCloser(strings.NewReader(content))
+			obj.ContentLength = aws.Int64(int64(len(content)))
+			return obj, nil
+		}
+		first, last := 0, len(content)-1
+		if strings.HasSuffix(rangeHeader, "-") {
+			fmt.Sscanf(rangeHeader, "bytes=%d-", &first) // nolint
+		} else {
+			fmt.Sscanf(rangeHeader, "bytes=%d-%d", &first, &last) // nolint
+		}
+		if first >= len(content) {
+			return nil, awserr.New("InvalidRange", "invalid range", nil)
+		}
+		if last >= len(content) {
+			last = len(content) - 1
+		}
+		obj.Body = ioutil.NopCloser(strings.NewReader(content[first : last+1]))
+		obj.ContentLength = aws.Int64(int64(last - first + 1))
+		obj.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", first, last, len(content)))
+		return obj, nil
+	}
+}
+
+func withParallelGet(threshold, partSize int64, concurrency int) func() {
+	c := config.Config
+	c.ParallelGetThreshold, c.ParallelGetPartSize, c.ParallelGetConcurrency = threshold, partSize, concurrency
+	return func() {
+		c.ParallelGetThreshold, c.ParallelGetPartSize, c.ParallelGetConcurrency = 0, 8*1024*1024, 4
+	}
+}
+
+func TestGetParallel(t *testing.T) {
+	defer withParallelGet(50, 10, 3)()
+
+	for _, c := range []struct {
+		size      int
+		requested []string
+	}{
+		// Smaller than a part
+		{5, []string{"bytes=0-9"}},
+		// Up to the threshold, the rest is streamed from a single GET
+		{30, []string{"bytes=0-9", "bytes=10-"}},
+		{50, []string{"bytes=0-9", "bytes=10-"}},
+		// Larger than the threshold
+		{55, []string{"bytes=0-9", "bytes=10-19", "bytes=20-29", "bytes=30-39", "bytes=40-49", "bytes=50-54"}},
+		// Empty objects have no range to satisfy
+		{0, []string{"bytes=0-9", ""}},
+	} {
+		content := strings.Repeat("0123456789", 6)[:c.size]
+		requested := []string{}
+		obj, err := getParallel(context.Background(), getFrom(content, &requested), "bucket", "key")
+		assert.Nil(t, err)
+
+		body, err := ioutil.ReadAll(obj.Body)
+		obj.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(body))
+		assert.Equal(t, int64(c.size), aws.Int64Value(obj.ContentLength))
+		assert.Nil(t, obj.ContentRange)
+		sort.Strings(requested[1:])
+		assert.Equal(t, c.requested, requested, c.size)
+	}
+}
+
+func TestPlanParts(t *testing.T) {
+	assert.Equal(t, []string{"bytes=8-15", "bytes=16-19"}, planParts(8, 20, 8))
+	assert.Equal(t, []string{}, planParts(20, 20, 8))
+}
+
+func TestTotalSize(t *testing.T) {
+	size, err := totalSize(aws.String("bytes 0-99/1234"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), size)
+
+	_, err = totalSize(aws.String("bytes 0-99/*"))
+	assert.NotNil(t, err)
+	_, err = totalSize(nil)
+	assert.NotNil(t, err)
+}
@@ -35,15 +35,41 @@ func main() {
 
 	// Listen & Serve
 	addr := net.JoinHostPort(config.Config.Host, config.Config.Port)
-	log.Printf("[service] listening on %s", addr)
-
-	if (len(config.Config.SslCert) > 0) && (len(config.Config.SslKey) > 0) {
-		log.Fatal(http.ListenAndServeTLS(
-			addr, config.Config.SslCert, config.Config.SslKey, nil,
-		))
-	} else {
-		log.Fatal(http.ListenAndServe(addr, nil))
+	listener, err := common.Listen(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !common.TLSEnabled() {
+		log.Printf("[service] listening on %s", listener.Addr())
+		log.Fatal(http.Serve(listener, nil))
+	}
+	tlsConfig, err := common.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// ACME HTTP-01 challenges
+	if common.ACMEEnabled() && len(config.Config.AcmeHTTPPort) > 0 {
+		go func() {
+			challenge := net.JoinHostPort(config.Config.Host, config.Config.AcmeHTTPPort)
+			log.Printf("[service] listening on %s for ACME challenges", challenge)
+			log.Fatal(http.ListenAndServe(challenge, common.ACMEHTTPHandler(nil)))
+		}()
+	}
+	// Plain HTTP alongside HTTPS
+	if len(config.Config.HTTPSPort) > 0 {
+		plain := listener
+		go func() {
+			log.Printf("[service] listening on %s", plain.Addr())
+			log.Fatal(http.Serve(plain, common.PlainHTTPHandler(http.DefaultServeMux)))
+		}()
+		listener, err = common.ListenHTTPS(net.JoinHostPort(config.Config.Host, config.Config.HTTPSPort))
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
+	log.Printf("[service] listening on %s (TLS)", listener.Addr())
+	server := &http.Server{TLSConfig: tlsConfig}
+	log.Fatal(server.ServeTLS(listener, "", ""))
 }
 
 func validateAwsConfigurations() {